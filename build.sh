@@ -1,3 +1,4 @@
 set -euo pipefail
 
-cd server && go build -o bin/
\ No newline at end of file
+# sqlite_fts5 enables full text search, without it search falls back to LIKE
+cd server && go build -tags sqlite_fts5 -o bin/
\ No newline at end of file
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"widiff/comparison"
+	"widiff/feed"
+)
+
+// storedDiff is a diff as served by the history API.
+type storedDiff struct {
+	feed.Diff
+	SelectedAt string   `json:"selected_at"`
+	Windows    []string `json:"windows"`
+	// Compacted diffs are past retention, see db.Retention
+	Compacted bool `json:"compacted,omitempty"`
+	// Permalink is the page showing this diff
+	Permalink string `json:"permalink"`
+}
+
+type diffsPage struct {
+	Diffs []storedDiff `json:"diffs"`
+	// Next is the cursor of the next page, empty on the last one
+	Next string `json:"next,omitempty"`
+}
+
+func toStoredDiff(c comparison.Comparison) storedDiff {
+	windows := c.Windows
+	if windows == nil {
+		windows = []string{}
+	}
+	diff := feed.ToJsonDiff(c.Diff)
+	// reviews that never arrived are just missing in the history
+	diff.ReviewPending = false
+	return storedDiff{
+		Diff:       diff,
+		SelectedAt: c.SelectedAt.UTC().Format(time.RFC3339),
+		Windows:    windows,
+		Compacted:  c.Compacted,
+		Permalink:  fmt.Sprintf("/?id=%d", c.ID),
+	}
+}
+
+// registerAPI serves the stored diffs:
+//
+//	GET /api/diffs?from=&to=&window=&wiki=&cursor=&limit=
+//
+// from and to are dates or RFC 3339 times, to is exclusive and a date
+// includes its whole day.
+//
+//	GET /api/diffs/{id}
+func registerAPI(serveMux *http.ServeMux, repo comparison.Repository) {
+	serveMux.HandleFunc("GET /api/diffs",
+		func(w http.ResponseWriter, r *http.Request) {
+			query, err := parseQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			page, err := repo.List(r.Context(), query)
+			if errors.Is(err, comparison.ErrBadCursor) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				log.Printf("error listing diffs: %s\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			resp := diffsPage{Diffs: make([]storedDiff, len(page.Comparisons)), Next: page.Next}
+			for i, c := range page.Comparisons {
+				resp.Diffs[i] = toStoredDiff(c)
+				// bodies are fetched one at a time through the permalink
+				resp.Diffs[i].DiffString = ""
+			}
+			writeJson(w, resp)
+		})
+
+	serveMux.HandleFunc("GET /api/diffs/{id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid id", http.StatusBadRequest)
+				return
+			}
+			c, err := repo.Get(r.Context(), id)
+			if errors.Is(err, comparison.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("error getting diff %d: %s\n", id, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writeJson(w, toStoredDiff(c))
+		})
+}
+
+type searchResult struct {
+	storedDiff
+	// Snippet is HTML with the matches wrapped in <mark>
+	Snippet string `json:"snippet"`
+}
+
+// registerSearch serves full text search over the stored diffs:
+//
+//	GET /api/search?q=&wiki=&from=&to=&limit=&offset=
+func registerSearch(serveMux *http.ServeMux, searcher comparison.Searcher) {
+	serveMux.HandleFunc("GET /api/search",
+		func(w http.ResponseWriter, r *http.Request) {
+			text := r.URL.Query().Get("q")
+			if text == "" {
+				http.Error(w, "missing q", http.StatusBadRequest)
+				return
+			}
+			query, err := parseQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			search := comparison.SearchQuery{
+				Text:  text,
+				Wiki:  query.Wiki,
+				From:  query.From,
+				To:    query.To,
+				Limit: query.Limit,
+			}
+			if value := r.URL.Query().Get("offset"); value != "" {
+				if search.Offset, err = strconv.Atoi(value); err != nil || search.Offset < 0 {
+					http.Error(w, fmt.Sprintf("invalid offset %q", value), http.StatusBadRequest)
+					return
+				}
+			}
+
+			results, err := searcher.Search(r.Context(), search)
+			if err != nil {
+				log.Printf("error searching diffs: %s\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			resp := make([]searchResult, len(results))
+			for i, result := range results {
+				resp[i] = searchResult{storedDiff: toStoredDiff(result.Comparison), Snippet: result.Snippet}
+				resp[i].DiffString = ""
+			}
+			writeJson(w, resp)
+		})
+}
+
+func parseQuery(r *http.Request) (comparison.Query, error) {
+	params := r.URL.Query()
+	query := comparison.Query{
+		Wiki:   params.Get("wiki"),
+		Window: params.Get("window"),
+		Cursor: params.Get("cursor"),
+	}
+	var err error
+	if value := params.Get("from"); value != "" {
+		if query.From, err = parseTime(value); err != nil {
+			return query, fmt.Errorf("invalid from %q", value)
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if query.To, err = parseTime(value); err != nil {
+			return query, fmt.Errorf("invalid to %q", value)
+		}
+		// the day named by a date is included, the bound is the next midnight
+		if _, err := time.Parse(time.DateOnly, value); err == nil {
+			query.To = query.To.Add(24 * time.Hour)
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 0 {
+			return query, fmt.Errorf("invalid limit %q", value)
+		}
+	}
+	return query, nil
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error encoding response: %s\n", err)
+	}
+}
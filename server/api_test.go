@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"widiff/db"
+	"widiff/wiki"
+	"widiff/wiki_api"
+)
+
+func TestHistoryAPI(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		diff := wiki_api.Diff{
+			Wiki:       "enwiki",
+			DiffString: "--- a\n+++ b\n+x\n",
+			Size:       i,
+			Change:     wiki.RecentChange{Title: fmt.Sprintf("Page %d", i)},
+		}
+		if _, err := database.Save(ctx, t0.Add(time.Duration(i)*time.Minute), diff); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serveMux := http.NewServeMux()
+	registerAPI(serveMux, database)
+	registerSearch(serveMux, database)
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	var page diffsPage
+	getJson(t, server.URL+"/api/diffs?wiki=enwiki&limit=2&from=2026-10-01", http.StatusOK, &page)
+	if len(page.Diffs) != 2 || page.Diffs[0].Title != "Page 2" || page.Next == "" {
+		t.Fatalf("wrong first page, got=%+v", page)
+	}
+	if page.Diffs[0].DiffString != "" {
+		t.Errorf("expected list without bodies")
+	}
+	next := page.Next
+	page = diffsPage{}
+	getJson(t, server.URL+"/api/diffs?wiki=enwiki&limit=2&cursor="+next, http.StatusOK, &page)
+	if len(page.Diffs) != 1 || page.Diffs[0].Title != "Page 0" || page.Next != "" {
+		t.Fatalf("wrong last page, got=%+v", page)
+	}
+
+	var diff storedDiff
+	getJson(t, fmt.Sprintf("%s/api/diffs/%d", server.URL, page.Diffs[0].ID), http.StatusOK, &diff)
+	if diff.Title != "Page 0" || diff.DiffString == "" || diff.SelectedAt != "2026-10-01T12:00:00Z" {
+		t.Errorf("wrong permalink diff, got=%+v", diff)
+	}
+
+	// a date includes its whole day
+	for to, expected := range map[string]int{"2026-10-01": 3, "2026-09-30": 0, "2026-10-01T12:01:00Z": 1} {
+		page = diffsPage{}
+		getJson(t, server.URL+"/api/diffs?to="+to, http.StatusOK, &page)
+		if len(page.Diffs) != expected {
+			t.Errorf("wrong diffs to %s, expected=%d, got=%d", to, expected, len(page.Diffs))
+		}
+	}
+
+	var results []searchResult
+	getJson(t, server.URL+"/api/search?q=page+1&wiki=enwiki", http.StatusOK, &results)
+	if len(results) != 1 || results[0].Title != "Page 1" || !strings.Contains(results[0].Snippet, "<mark>") {
+		t.Errorf("wrong search results, got=%+v", results)
+	}
+	getJson(t, server.URL+"/api/search", http.StatusBadRequest, nil)
+
+	getJson(t, server.URL+"/api/diffs/999", http.StatusNotFound, nil)
+	getJson(t, server.URL+"/api/diffs/abc", http.StatusBadRequest, nil)
+	getJson(t, server.URL+"/api/diffs?from=yesterday", http.StatusBadRequest, nil)
+	getJson(t, server.URL+"/api/diffs?cursor=garbage", http.StatusBadRequest, nil)
+}
+
+func getJson(t *testing.T, url string, status int, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if status != 0 && resp.StatusCode != status {
+		t.Fatalf("wrong status for %s, expected=%d, got=%d", url, status, resp.StatusCode)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
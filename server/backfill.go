@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+	"widiff/db"
+	"widiff/feed"
+	"widiff/wiki_api"
+)
+
+const backfillUsage = `usage: widiff backfill --from 2026-10-01 --to 2026-10-02 [--wiki enwiki]
+
+Computes the top diff of every minute between from and to like the live feed
+does and stores it in the database at WIDIFF_DB. An interrupted backfill
+resumes where it stopped when run again with the same arguments.
+`
+
+// runBackfill is the backfill command, args excludes the command name.
+func runBackfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), backfillUsage)
+		flags.PrintDefaults()
+	}
+	from := flags.String("from", "", "start of the range, a date or RFC 3339 time (UTC)")
+	to := flags.String("to", "", "end of the range, a date or RFC 3339 time (UTC)")
+	wikiID := flags.String("wiki", "enwiki", "wiki to backfill")
+	every := flags.Duration("every", time.Minute, "interval between top diffs")
+	flags.Parse(args)
+
+	if *from == "" || *to == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	fromTime, err := parseTime(*from)
+	if err != nil {
+		log.Fatalf("--from: %s", err)
+	}
+	toTime, err := parseTime(*to)
+	if err != nil {
+		log.Fatalf("--to: %s", err)
+	}
+	if !toTime.After(fromTime) {
+		log.Fatalf("--to must be after --from")
+	}
+
+	timeframes := timeframesFromEnv()
+	client, err := newClient(*wikiID, timeframes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	database := databaseFromEnv()
+	if database == nil {
+		log.Fatalf("backfill needs a database, WIDIFF_DB is off")
+	}
+	defer database.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	b := &backfill{
+		Wiki:       *wikiID,
+		From:       fromTime,
+		To:         toTime,
+		Every:      *every,
+		Source:     client,
+		DB:         database,
+		Timeframes: timeframes,
+	}
+	if err := b.Run(ctx); err != nil {
+		log.Fatalf("backfill stopped, run again to resume: %s", err)
+	}
+}
+
+// parseTime accepts a date or an RFC 3339 time, dates are UTC.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// revisionOnly reports whether err fails the minute for good: it had no
+// changes or every candidate failed for its revision. An HTML error page
+// from any compare is taken for an outage.
+func revisionOnly(err error) bool {
+	if errors.Is(err, wiki_api.ErrNoChanges) {
+		return true
+	}
+	var candidatesErr *wiki_api.CandidatesError
+	var contentErr *wiki_api.ContentTypeError
+	return errors.As(err, &candidatesErr) && !errors.As(err, &contentErr)
+}
+
+// rangeSource returns the top diff of a past time range, see
+// wiki_api.Client.TopDiffBetween.
+type rangeSource interface {
+	TopDiffBetween(ctx context.Context, from, to time.Time) (wiki_api.Diff, error)
+}
+
+// backfill replays the feed over [From, To]: every Every it selects the top
+// diff of the last feed.Lookback, stores it and records the windows it wins.
+type backfill struct {
+	Wiki       string
+	From, To   time.Time
+	Every      time.Duration
+	Source     rangeSource
+	DB         *db.DB
+	Timeframes []feed.Timeframe
+}
+
+func (b *backfill) checkpointName() string {
+	return fmt.Sprintf("backfill %s %s %s", b.Wiki, b.From.Format(time.RFC3339), b.To.Format(time.RFC3339))
+}
+
+func (b *backfill) Run(ctx context.Context) error {
+	name := b.checkpointName()
+	start := b.From.Add(b.Every)
+	done, ok, err := b.DB.Checkpoint(ctx, name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		start = done.Add(b.Every)
+		log.Printf("resuming %s after %s\n", b.Wiki, done)
+	}
+
+	buffs, err := b.warm(ctx, start)
+	if err != nil {
+		return err
+	}
+
+	for at := start; !at.After(b.To); at = at.Add(b.Every) {
+		if err := b.step(ctx, name, buffs, at); err != nil {
+			return err
+		}
+	}
+	log.Printf("backfilled %s from %s to %s\n", b.Wiki, b.From, b.To)
+	return nil
+}
+
+// warm fills the buffers with the diffs a previous run stored before start,
+// so the windows recorded after resuming are the same as in one go.
+func (b *backfill) warm(ctx context.Context, start time.Time) (*feed.Buffers, error) {
+	buffs := feed.NewBuffers(b.Timeframes...)
+	longest := buffs.Timeframes[len(buffs.Timeframes)-1].Duration
+	stored, err := b.DB.Since(ctx, b.Wiki, start.Add(-longest))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range stored {
+		if c.SelectedAt.Before(start) {
+			buffs.Update(c.SelectedAt, c.Diff)
+		}
+	}
+	return buffs, nil
+}
+
+// step checkpoints at once its diff is stored or the minute turned out to
+// have nothing to store: no changes, or only candidates that fail for their
+// revision and would fail again. Any other error stops the run, so the
+// minute is fetched again on resume instead of being lost.
+func (b *backfill) step(ctx context.Context, name string, buffs *feed.Buffers, at time.Time) error {
+	diff, err := b.Source.TopDiffBetween(ctx, at.Add(-feed.Lookback), at)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !revisionOnly(err) {
+			return err
+		}
+		log.Printf("no top diff at %s: %s\n", at, err)
+		var candidatesErr *wiki_api.CandidatesError
+		if errors.As(err, &candidatesErr) {
+			for _, s := range candidatesErr.Skipped {
+				log.Printf("skipped %s (rev %d, %d bytes) at %s: %s\n", s.Title, s.RevID, s.Size, at, s.Reason)
+			}
+		}
+		return b.DB.SetCheckpoint(ctx, name, at)
+	}
+
+	// a crash between saving and checkpointing would store the diff twice
+	return b.DB.InTx(ctx, func(tx *db.Tx) error {
+		diff.ID, err = tx.Save(ctx, at, diff)
+		if err != nil {
+			return err
+		}
+		buffs.Update(at, diff)
+		if err := feed.SaveWindows(ctx, tx, buffs.Report(at), at); err != nil {
+			return err
+		}
+		return tx.SetCheckpoint(ctx, name, at)
+	})
+}
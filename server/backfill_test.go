@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+	"widiff/db"
+	"widiff/feed"
+	"widiff/wiki_api"
+)
+
+// scriptedSource returns a diff sized by the minute of to and fails once at
+// failAt with failWith.
+type scriptedSource struct {
+	failAt   time.Time
+	failWith error
+	calls    []time.Time
+}
+
+func (s *scriptedSource) TopDiffBetween(ctx context.Context, from, to time.Time) (wiki_api.Diff, error) {
+	s.calls = append(s.calls, to)
+	if to.Equal(s.failAt) {
+		s.failAt = time.Time{}
+		return wiki_api.Diff{}, s.failWith
+	}
+	if to.Sub(from) != feed.Lookback {
+		return wiki_api.Diff{}, errors.New("wrong lookback")
+	}
+	if to.Minute() == 3 {
+		return wiki_api.Diff{}, fmt.Errorf("%w since %s", wiki_api.ErrNoChanges, from)
+	}
+	return wiki_api.Diff{Wiki: "enwiki", Size: to.Minute()}, nil
+}
+
+func TestBackfillResumes(t *testing.T) {
+	// errors that outlast the retries, the minute is fetched again on resume
+	outages := []error{
+		&wiki_api.TransportError{StatusCode: 503},
+		&wiki_api.APIError{Code: "maxlag"},
+		&wiki_api.ContentTypeError{ContentType: "text/html"},
+		&wiki_api.CandidatesError{Errs: []error{&wiki_api.ContentTypeError{ContentType: "text/html"}}},
+	}
+	for _, outage := range outages {
+		t.Run(fmt.Sprintf("%T", outage), func(t *testing.T) {
+			testBackfillResumes(t, outage)
+		})
+	}
+}
+
+func testDB(t *testing.T) *db.DB {
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func testBackfillResumes(t *testing.T, outage error) {
+	database := testDB(t)
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	source := &scriptedSource{failAt: from.Add(4 * time.Minute), failWith: outage}
+	b := &backfill{
+		Wiki:       "enwiki",
+		From:       from,
+		To:         from.Add(5 * time.Minute),
+		Every:      time.Minute,
+		Source:     source,
+		DB:         database,
+		Timeframes: feed.DefaultTimeframes(),
+	}
+
+	ctx := context.Background()
+	if err := b.Run(ctx); err == nil {
+		t.Fatalf("expected %v to stop the backfill", outage)
+	}
+	if err := b.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(source.calls) != 6 {
+		t.Errorf("wrong number of calls, expected=6, got=%d: %v", len(source.calls), source.calls)
+	}
+	stored, err := database.Since(ctx, "enwiki", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, c := range stored {
+		sizes = append(sizes, c.Diff.Size)
+	}
+	if len(sizes) != 4 || sizes[0] != 1 || sizes[3] != 5 {
+		t.Errorf("wrong stored diffs, expected=[1 2 4 5], got=%v", sizes)
+	}
+	// the resumed run still sees the earlier diffs in its windows
+	last := stored[len(stored)-1]
+	if len(last.Windows) != 3 {
+		t.Errorf("expected minute 5 to win every window, got=%v", last.Windows)
+	}
+}
+
+func TestBackfillSkipsFailedCandidates(t *testing.T) {
+	database := testDB(t)
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	// deleted revisions fail the same way on every run
+	deleted := &wiki_api.CandidatesError{
+		Skipped: []wiki_api.SkippedCandidate{{Title: "Gone", RevID: 7, Size: 900, Reason: "nosuchrevid"}},
+		Errs:    []error{&wiki_api.APIError{Code: "nosuchrevid"}},
+	}
+	source := &scriptedSource{failAt: from.Add(4 * time.Minute), failWith: deleted}
+	b := &backfill{
+		Wiki:       "enwiki",
+		From:       from,
+		To:         from.Add(5 * time.Minute),
+		Every:      time.Minute,
+		Source:     source,
+		DB:         database,
+		Timeframes: feed.DefaultTimeframes(),
+	}
+
+	ctx := context.Background()
+	if err := b.Run(ctx); err != nil {
+		t.Fatalf("expected the minute to be skipped, got=%v", err)
+	}
+	if len(source.calls) != 5 {
+		t.Errorf("wrong number of calls, expected=5, got=%d: %v", len(source.calls), source.calls)
+	}
+	done, ok, err := database.Checkpoint(ctx, b.checkpointName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !done.Equal(b.To) {
+		t.Errorf("wrong checkpoint, expected=%v, got=%v (%v)", b.To, done, ok)
+	}
+	stored, err := database.Since(ctx, "enwiki", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, c := range stored {
+		sizes = append(sizes, c.Diff.Size)
+	}
+	if fmt.Sprint(sizes) != "[1 2 5]" {
+		t.Errorf("wrong stored diffs, expected=[1 2 5], got=%v", sizes)
+	}
+}
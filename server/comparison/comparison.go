@@ -1,4 +1,93 @@
 package comparison
 
+import (
+	"context"
+	"errors"
+	"time"
+	wikiapi "widiff/wiki_api"
+)
+
+// ErrNotFound is returned for ids that are not stored.
+var ErrNotFound = errors.New("comparison not found")
+
+// Comparison is a diff the feed selected, as stored by a Repository.
+type Comparison struct {
+	ID int64
+	// SelectedAt is when the feed picked the diff, it places the diff in the
+	// time windows
+	SelectedAt time.Time
+	Diff       wikiapi.Diff
+	// Windows are the windows the diff was the largest of
+	Windows []string
+	// Compacted diffs are past retention, only window winners keep their
+	// body
+	Compacted bool
+}
+
+// Query selects stored diffs, zero fields do not filter.
+type Query struct {
+	Wiki string
+	// From and To bound SelectedAt, From inclusive and To exclusive
+	From, To time.Time
+	// Window keeps diffs that were the largest of the named window
+	Window string
+	// Cursor continues after the last diff of a previous Page
+	Cursor string
+	Limit  int
+}
+
+// Page is a batch of stored diffs, newest first. Next is empty on the last
+// page.
+type Page struct {
+	Comparisons []Comparison
+	Next        string
+}
+
+// ErrBadCursor is returned for cursors that did not come from a Page.
+var ErrBadCursor = errors.New("invalid cursor")
+
+// Repository stores every diff the feed selects along with its review.
 type Repository interface {
+	// Save stores a newly selected diff and returns its id.
+	Save(ctx context.Context, selectedAt time.Time, diff wikiapi.Diff) (int64, error)
+	// SetReview replaces the review of a stored diff, which is no longer
+	// pending.
+	SetReview(ctx context.Context, id int64, review string) error
+	// AddWindow records that the diff was the largest of window at the time
+	// of a report.
+	AddWindow(ctx context.Context, id int64, window string, at time.Time) error
+	Get(ctx context.Context, id int64) (Comparison, error)
+	// Since returns the diffs of wiki selected at or after since, oldest
+	// first.
+	Since(ctx context.Context, wiki string, since time.Time) ([]Comparison, error)
+	// List pages through the stored diffs matching query.
+	List(ctx context.Context, query Query) (Page, error)
+}
+
+// WindowRecorder records the windows stored diffs won, see
+// Repository.AddWindow.
+type WindowRecorder interface {
+	AddWindow(ctx context.Context, id int64, window string, at time.Time) error
+}
+
+// SearchQuery is a full text search over title, comment, diff and review,
+// zero fields other than Text do not filter.
+type SearchQuery struct {
+	Text string
+	Wiki string
+	// From and To bound SelectedAt like in Query
+	From, To time.Time
+	Limit    int
+	Offset   int
+}
+
+type SearchResult struct {
+	Comparison Comparison
+	// Snippet is HTML, the matched terms wrapped in <mark>
+	Snippet string
+}
+
+// Searcher finds stored diffs by text.
+type Searcher interface {
+	Search(ctx context.Context, query SearchQuery) ([]SearchResult, error)
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"widiff/db"
+	"widiff/feed"
+	"widiff/llm"
+	"widiff/wiki_api"
+)
+
+// rankerFromEnv returns nil when the variable is unset, which keeps the
+// default ranking by byte delta.
+func rankerFromEnv(key string) wiki_api.Ranker {
+	name, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	ranker, err := wiki_api.RankerByName(name)
+	if err != nil {
+		log.Fatalf("%s: %s", key, err)
+	}
+	return ranker
+}
+
+// timeframesFromEnv reads WIDIFF_TIMEFRAMES, see feed.ParseTimeframes, the
+// ranker of each timeframe from WIDIFF_RANKER_<NAME>, e.g.
+// WIDIFF_RANKER_HOUR or WIDIFF_RANKER_5M, and the leaderboard length from
+// WIDIFF_LEADERBOARD_SIZE.
+func timeframesFromEnv() []feed.Timeframe {
+	timeframes := feed.DefaultTimeframes()
+	if spec := os.Getenv("WIDIFF_TIMEFRAMES"); spec != "" {
+		var err error
+		timeframes, err = feed.ParseTimeframes(spec)
+		if err != nil {
+			log.Fatalf("WIDIFF_TIMEFRAMES: %s", err)
+		}
+	}
+	topN := intFromEnv("WIDIFF_LEADERBOARD_SIZE")
+	for i, t := range timeframes {
+		timeframes[i].Ranker = rankerFromEnv("WIDIFF_RANKER_" + strings.ToUpper(t.Name))
+		timeframes[i].TopN = topN
+	}
+	return timeframes
+}
+
+// databaseFromEnv opens and migrates the database at WIDIFF_DB, db.DefaultPath
+// if unset. WIDIFF_DB=off keeps diffs in memory only and returns nil.
+func databaseFromEnv() *db.DB {
+	path, ok := os.LookupEnv("WIDIFF_DB")
+	if !ok {
+		path = db.DefaultPath
+	}
+	if path == "off" {
+		return nil
+	}
+	database, err := db.Open(path)
+	if err != nil {
+		log.Fatalf("WIDIFF_DB: %s", err)
+	}
+	if err := database.Init(); err != nil {
+		log.Fatalf("WIDIFF_DB: %s", err)
+	}
+	return database
+}
+
+// retentionFromEnv reads how many days diffs keep their full body from
+// WIDIFF_RETENTION_DAYS and whose winners keep a compressed body from
+// WIDIFF_RETENTION_WINDOWS, see db.DefaultRetention for the defaults.
+func retentionFromEnv() db.Retention {
+	retention := db.DefaultRetention
+	if days := intFromEnv("WIDIFF_RETENTION_DAYS"); days > 0 {
+		retention.FullBodies = time.Duration(days) * 24 * time.Hour
+	}
+	if windows := listFromEnv("WIDIFF_RETENTION_WINDOWS"); windows != nil {
+		retention.KeepWindows = windows
+	}
+	return retention
+}
+
+// durationFromEnv returns fallback when the variable is unset.
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := feed.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s: %s", key, err)
+	}
+	return d
+}
+
+// snapshotterFromEnv snapshots the buffers to the file at WIDIFF_SNAPSHOT.
+// If unset the feed warms its buffers from the database, if any.
+func snapshotterFromEnv() feed.Snapshotter {
+	path := os.Getenv("WIDIFF_SNAPSHOT")
+	if path == "" {
+		return nil
+	}
+	return feed.FileSnapshotter{Path: path}
+}
+
+func filterConfigFromEnv() wiki_api.FilterConfig {
+	return wiki_api.FilterConfig{
+		ExcludeBots:         boolFromEnv("WIDIFF_EXCLUDE_BOTS"),
+		ExcludeAnonymous:    boolFromEnv("WIDIFF_EXCLUDE_ANON"),
+		ExcludeMinor:        boolFromEnv("WIDIFF_EXCLUDE_MINOR"),
+		ExcludeTags:         listFromEnv("WIDIFF_EXCLUDE_TAGS"),
+		IncludeNamespaces:   intsFromEnv("WIDIFF_NAMESPACES"),
+		ExcludeNamespaces:   intsFromEnv("WIDIFF_EXCLUDE_NAMESPACES"),
+		TitlePattern:        os.Getenv("WIDIFF_TITLE_REGEX"),
+		ExcludeTitlePattern: os.Getenv("WIDIFF_EXCLUDE_TITLE_REGEX"),
+	}
+}
+
+func boolFromEnv(key string) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s: %s", key, err)
+	}
+	return b
+}
+
+func listFromEnv(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// intFromEnv returns 0 when the variable is unset.
+func intFromEnv(key string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s: %s", key, err)
+	}
+	return i
+}
+
+func intsFromEnv(key string) []int {
+	var ints []int
+	for _, value := range listFromEnv(key) {
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			log.Fatalf("%s: %s", key, err)
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
+// generatorFromEnv builds the reviewer named by WIDIFF_LLM, see
+// llm.Providers, configured by WIDIFF_LLM_MODEL, WIDIFF_LLM_URL,
+// WIDIFF_LLM_API_KEY, WIDIFF_LLM_TEMPLATE and WIDIFF_LLM_MAX_TOKENS. Unset, it
+// is gemini if GEMINI_API_KEY is set. Without a key diffs go unreviewed.
+func generatorFromEnv() feed.Generator {
+	config := llm.Config{
+		Provider:  os.Getenv("WIDIFF_LLM"),
+		Model:     os.Getenv("WIDIFF_LLM_MODEL"),
+		BaseURL:   os.Getenv("WIDIFF_LLM_URL"),
+		APIKey:    os.Getenv("WIDIFF_LLM_API_KEY"),
+		Template:  os.Getenv("WIDIFF_LLM_TEMPLATE"),
+		MaxTokens: intFromEnv("WIDIFF_LLM_MAX_TOKENS"),
+	}
+	if config.Provider == "" {
+		config.Provider = "gemini"
+	}
+	if config.APIKey == "" {
+		switch config.Provider {
+		case "gemini":
+			config.APIKey = os.Getenv("GEMINI_API_KEY")
+		case "openai":
+			config.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
+	}
+
+	generator, err := llm.New(config)
+	if errors.Is(err, llm.ErrNoAPIKey) {
+		log.Printf("%s, running without reviews\n", err)
+		return llm.None{}
+	}
+	if err != nil {
+		log.Fatalf("WIDIFF_LLM: %s", err)
+	}
+	log.Printf("reviewing with %s\n", config.Provider)
+	return generator
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	wikiapi "widiff/wiki_api"
+)
+
+// Checkpoint returns how far the job name got, ok is false if it never
+// checkpointed.
+func (db *DB) Checkpoint(ctx context.Context, name string) (at time.Time, ok bool, err error) {
+	var unix int64
+	err = db.QueryRowContext(ctx,
+		fmt.Sprintf("select at from %s where name = ?", db.checkpointsTable.Name()),
+		name,
+	).Scan(&unix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(unix, 0).UTC(), true, nil
+}
+
+func (db *DB) SetCheckpoint(ctx context.Context, name string, at time.Time) error {
+	return db.setCheckpoint(ctx, db.DB, name, at)
+}
+
+func (db *DB) setCheckpoint(ctx context.Context, ex execer, name string, at time.Time) error {
+	_, err := ex.ExecContext(ctx, db.checkpointsTable.Insert(), name, at.Unix())
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint %s: %v", name, err)
+	}
+	return nil
+}
+
+// Tx stores diffs, windows and checkpoints like DB within a transaction.
+type Tx struct {
+	db *DB
+	tx *sql.Tx
+}
+
+func (tx *Tx) Save(ctx context.Context, selectedAt time.Time, diff wikiapi.Diff) (int64, error) {
+	return tx.db.save(ctx, tx.tx, selectedAt, diff)
+}
+
+func (tx *Tx) AddWindow(ctx context.Context, id int64, window string, at time.Time) error {
+	return tx.db.addWindow(ctx, tx.tx, id, window, at)
+}
+
+func (tx *Tx) SetCheckpoint(ctx context.Context, name string, at time.Time) error {
+	return tx.db.setCheckpoint(ctx, tx.tx, name, at)
+}
+
+// InTx runs fn in a transaction that is committed if fn returns nil, so a
+// job can store its results and its checkpoint together. fn must not use db,
+// the transaction holds its only connection.
+func (db *DB) InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	sqlTx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+	if err := fn(&Tx{db: db, tx: sqlTx}); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
@@ -8,174 +8,209 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DefaultPath is where the server keeps its database.
+const DefaultPath = "./foo.db"
+
 type Table interface {
+	Name() string
 	Create() string
 	Insert() string
 }
 
+// DiffsTable holds every diff the feed selected. Times are unix seconds,
+// change, lines and skipped are JSON.
 type DiffsTable struct{}
 
 func (diffsTable *DiffsTable) Name() string {
 	return "diffs"
 }
 
-func (diffTable *DiffsTable) Create() string {
-	return `
+func (diffsTable *DiffsTable) Create() string {
+	return fmt.Sprintf(`
 	create table if not exists
-		diff (
-			id integer not null primary key autoincrement,
-			FromID    integer  ,
-			FromRevID integer  ,
-			FromNS    integer  ,
-			FromTitle text     ,
-			ToID      integer  ,
-			ToRevID   integer  ,
-			ToNS      integer  ,
-			ToTitle   text     ,
-			Body      text     ,
+		%s (
+			id          integer not null primary key autoincrement,
+			wiki        text    not null,
+			title       text    not null,
+			page_id     integer not null,
+			ns          integer not null,
+			rev_id      integer not null,
+			old_rev_id  integer not null,
+			user        text    not null,
+			comment     text    not null,
+			size        integer not null,
+			views       integer not null,
+			edited_at   integer not null,
+			selected_at integer not null,
+			body        text    not null,
+			review      text    not null default '',
+			change      text    not null,
+			lines       text    not null,
+			skipped     text    not null
 		);
 
-	delete from diffs;
-	`
+	create index if not exists
+		diffs_wiki_selected_at on %[1]s (wiki, selected_at);
+	`, diffsTable.Name())
 }
 
-func (diffTable *DiffsTable) Insert(
-	FromRevID int,
-	FromNS int,
-	FromTitle string,
-	ToID int,
-	ToRevID int,
-	ToNS int,
-	ToTitle string,
-	Body string,
-) string {
+func (diffsTable *DiffsTable) Insert() string {
 	return fmt.Sprintf(`
 		insert into %s(
-			id,
-			FromID,
-			FromRevID ,
-			FromNS    ,
-			FromTitle ,
-			ToID      ,
-			ToRevID   ,
-			ToNS      ,
-			ToTitle   ,
-			Body
+			wiki,
+			title,
+			page_id,
+			ns,
+			rev_id,
+			old_rev_id,
+			user,
+			comment,
+			size,
+			views,
+			edited_at,
+			selected_at,
+			body,
+			review,
+			review_pending,
+			change,
+			lines,
+			skipped
 		)
-		values( ?, ?, ?, ?, ?, ?, ?, ?)`,
-		diffTable.Name(),
+		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		diffsTable.Name(),
 	)
 }
 
-type DB struct {
-	diffsTable DiffsTable
-	*sql.DB
+// WindowsTable records which windows a diff was the largest of, first_at
+// and last_at span the reports it won.
+type WindowsTable struct{}
+
+func (windowsTable *WindowsTable) Name() string {
+	return "windows"
 }
 
-func NewDb() (*DB, error) {
-	sqlDb, err := sql.Open("sqlite3", "./foo.db")
-	if err != nil {
-		return nil, err
-	}
-	return &DB{
-		diffsTable: DiffsTable{},
-		DB:         sqlDb,
-	}, nil
+func (windowsTable *WindowsTable) Create() string {
+	return fmt.Sprintf(`
+	create table if not exists
+		%s (
+			diff_id  integer not null references diffs(id) on delete cascade,
+			name     text    not null,
+			first_at integer not null,
+			last_at  integer not null,
+			primary key (diff_id, name)
+		);
+	`, windowsTable.Name())
 }
 
-func (db *DB) Init() error {
-	var dt DiffsTable
-	stmt := dt.Create()
-	_, err := db.Exec(stmt)
-	if err != nil {
-		log.Printf("%q: %s\n", err, stmt)
-		return err
-	}
-	return nil
+func (windowsTable *WindowsTable) Insert() string {
+	return fmt.Sprintf(`
+		insert into %s(diff_id, name, first_at, last_at)
+		values(?, ?, ?, ?)
+		on conflict(diff_id, name) do update set last_at = excluded.last_at`,
+		windowsTable.Name(),
+	)
 }
 
-func TestDb() {
+// CheckpointsTable keeps how far long running jobs got, keyed by job name.
+type CheckpointsTable struct{}
 
-	db, err := NewDb()
-	db.Init()
+func (checkpointsTable *CheckpointsTable) Name() string {
+	return "checkpoints"
+}
 
-	tx, err := db.Begin()
-	if err != nil {
-		log.Fatal(err)
-	}
-	stmt, err := tx.Prepare("insert into foo(id, name) values(?, ?)")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer stmt.Close()
-	for i := 0; i < 100; i++ {
-		_, err = stmt.Exec(i, fmt.Sprintf("こんにちは世界%03d", i))
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
-	err = tx.Commit()
-	if err != nil {
-		log.Fatal(err)
-	}
+func (checkpointsTable *CheckpointsTable) Create() string {
+	return fmt.Sprintf(`
+	create table if not exists
+		%s (
+			name text    not null primary key,
+			at   integer not null
+		);
+	`, checkpointsTable.Name())
+}
 
-	rows, err := db.Query("select id, name from foo")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var id int
-		var name string
-		err = rows.Scan(&id, &name)
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Println(id, name)
-	}
-	err = rows.Err()
-	if err != nil {
-		log.Fatal(err)
-	}
+func (checkpointsTable *CheckpointsTable) Insert() string {
+	return fmt.Sprintf(`
+		insert into %s(name, at)
+		values(?, ?)
+		on conflict(name) do update set at = excluded.at`,
+		checkpointsTable.Name(),
+	)
+}
 
-	stmt, err = db.Prepare("select name from foo where id = ?")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer stmt.Close()
-	var name string
-	err = stmt.QueryRow("3").Scan(&name)
-	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Println(name)
+// migrations are applied in order, the number of applied migrations is kept
+// in user_version. Only ever append to this list.
+var migrations = []string{
+	(&DiffsTable{}).Create() + (&WindowsTable{}).Create(),
+	(&CheckpointsTable{}).Create(),
+	// see Compact, compacted diffs keep a gzipped body or none at all
+	`
+	alter table diffs add column body_gz blob;
+	alter table diffs add column compacted_at integer not null default 0;
+	create index if not exists diffs_compacted_at on diffs (compacted_at, selected_at);
+	`,
+	// reviews are generated after the diff is stored, pending ones used to
+	// be stored as the review "pending"
+	`
+	alter table diffs add column review_pending integer not null default 0;
+	update diffs set review = '', review_pending = 1 where review = 'pending';
+	`,
+}
 
-	_, err = db.Exec("delete from foo")
-	if err != nil {
-		log.Fatal(err)
-	}
+type DB struct {
+	diffsTable       DiffsTable
+	windowsTable     WindowsTable
+	checkpointsTable CheckpointsTable
+	searchTable      SearchTable
+	// fts is set if the search index exists
+	fts bool
+	*sql.DB
+}
 
-	_, err = db.Exec("insert into foo(id, name) values(1, 'foo'), (2, 'bar'), (3, 'baz')")
+// Open opens the sqlite database at path, the file is created if needed.
+func Open(path string) (*DB, error) {
+	sqlDb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	// sqlite allows a single writer, queue on the pool instead of failing
+	// with database is locked
+	sqlDb.SetMaxOpenConns(1)
+	return &DB{DB: sqlDb}, nil
+}
 
-	rows, err = db.Query("select id, name from foo")
-	if err != nil {
-		log.Fatal(err)
+func NewDb() (*DB, error) {
+	return Open(DefaultPath)
+}
+
+// Init applies the migrations the database has not seen yet and sets up
+// the search index.
+func (db *DB) Init() error {
+	var version int
+	if err := db.QueryRow("pragma user_version").Scan(&version); err != nil {
+		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var id int
-		var name string
-		err = rows.Scan(&id, &name)
-		if err != nil {
-			log.Fatal(err)
+	for i := version; i < len(migrations); i++ {
+		if err := db.migrate(i+1, migrations[i]); err != nil {
+			return err
 		}
-		fmt.Println(id, name)
+		log.Printf("applied migration %d\n", i+1)
 	}
-	err = rows.Err()
+	return db.initSearch()
+}
+
+func (db *DB) migrate(version int, stmt string) error {
+	tx, err := db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(stmt); err != nil {
+		log.Printf("%q: %s\n", err, stmt)
+		return err
+	}
+	// pragmas do not take parameters
+	if _, err := tx.Exec(fmt.Sprintf("pragma user_version = %d", version)); err != nil {
+		return err
 	}
+	return tx.Commit()
 }
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"widiff/comparison"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+func (db *DB) List(ctx context.Context, query comparison.Query) (comparison.Page, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	var where []string
+	var args []any
+	if query.Wiki != "" {
+		where = append(where, "wiki = ?")
+		args = append(args, query.Wiki)
+	}
+	if !query.From.IsZero() {
+		where = append(where, "selected_at >= ?")
+		args = append(args, query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		where = append(where, "selected_at < ?")
+		args = append(args, query.To.Unix())
+	}
+	if query.Window != "" {
+		where = append(where, fmt.Sprintf(
+			"exists (select 1 from %s w where w.diff_id = %s.id and w.name = ?)",
+			db.windowsTable.Name(), db.diffsTable.Name(),
+		))
+		args = append(args, query.Window)
+	}
+	if query.Cursor != "" {
+		selectedAt, id, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return comparison.Page{}, err
+		}
+		// newest first, continue with what sorts after the cursor
+		where = append(where, "(selected_at < ? or (selected_at = ? and id < ?))")
+		args = append(args, selectedAt, selectedAt, id)
+	}
+
+	stmt := fmt.Sprintf("select %s from %s", diffColumns, db.diffsTable.Name())
+	if len(where) > 0 {
+		stmt += " where " + strings.Join(where, " and ")
+	}
+	stmt += " order by selected_at desc, id desc limit ?"
+	// one more than asked tells whether there is a next page
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return comparison.Page{}, err
+	}
+	comparisons, err := db.scan(ctx, rows)
+	if err != nil {
+		return comparison.Page{}, err
+	}
+
+	var page comparison.Page
+	if len(comparisons) > limit {
+		comparisons = comparisons[:limit]
+		last := comparisons[limit-1]
+		page.Next = encodeCursor(last.SelectedAt.Unix(), last.ID)
+	}
+	page.Comparisons = comparisons
+	return page, nil
+}
+
+func encodeCursor(selectedAt, id int64) string {
+	raw := strconv.FormatInt(selectedAt, 10) + "." + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (selectedAt, id int64, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, comparison.ErrBadCursor
+	}
+	at, rawID, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return 0, 0, comparison.ErrBadCursor
+	}
+	selectedAt, err = strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return 0, 0, comparison.ErrBadCursor
+	}
+	id, err = strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return 0, 0, comparison.ErrBadCursor
+	}
+	return selectedAt, id, nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"widiff/comparison"
+	wikiapi "widiff/wiki_api"
+)
+
+func TestListPages(t *testing.T) {
+	db := testDb(t)
+	ctx := context.Background()
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range 7 {
+		wikiID := "enwiki"
+		if i == 3 {
+			wikiID = "dewiki"
+		}
+		id, err := db.Save(ctx, t0.Add(time.Duration(i)*time.Minute), wikiapi.Diff{Wiki: wikiID, Size: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if err := db.AddWindow(ctx, id, "hour", t0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	list := func(query comparison.Query) []int {
+		t.Helper()
+		var sizes []int
+		for {
+			page, err := db.List(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range page.Comparisons {
+				sizes = append(sizes, c.Diff.Size)
+			}
+			if page.Next == "" {
+				return sizes
+			}
+			query.Cursor = page.Next
+		}
+	}
+
+	tests := []struct {
+		query    comparison.Query
+		expected string
+	}{
+		{comparison.Query{Limit: 2}, "[6 5 4 3 2 1 0]"},
+		{comparison.Query{Wiki: "enwiki", Limit: 4}, "[6 5 4 2 1 0]"},
+		{comparison.Query{Window: "hour", Limit: 1}, "[6 4 2 0]"},
+		{comparison.Query{From: t0.Add(2 * time.Minute), To: t0.Add(4 * time.Minute)}, "[3 2]"},
+	}
+	for _, test := range tests {
+		actual := fmt.Sprint(list(test.query))
+		if test.expected != actual {
+			t.Errorf("wrong diffs for %+v, expected=%s, got=%s", test.query, test.expected, actual)
+		}
+	}
+
+	if _, err := db.List(ctx, comparison.Query{Cursor: "garbage"}); !errors.Is(err, comparison.ErrBadCursor) {
+		t.Errorf("expected bad cursor, got=%v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"widiff/comparison"
+	wikiapi "widiff/wiki_api"
+)
+
+var _ comparison.Repository = (*DB)(nil)
+
+// diffColumns are selected by every query that scans a comparison.
+const diffColumns = `
+	id, wiki, user, comment, size, views, edited_at, selected_at,
+	body, body_gz, compacted_at, review, review_pending, change, lines, skipped`
+
+func (db *DB) Save(ctx context.Context, selectedAt time.Time, diff wikiapi.Diff) (int64, error) {
+	return db.save(ctx, db.DB, selectedAt, diff)
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (db *DB) save(ctx context.Context, ex execer, selectedAt time.Time, diff wikiapi.Diff) (int64, error) {
+	change, err := json.Marshal(diff.Change)
+	if err != nil {
+		return 0, err
+	}
+	lines, err := json.Marshal(diff.Lines)
+	if err != nil {
+		return 0, err
+	}
+	skipped, err := json.Marshal(diff.Skipped)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := ex.ExecContext(ctx, db.diffsTable.Insert(),
+		diff.Wiki,
+		diff.Change.Title,
+		diff.Change.PageID,
+		diff.Change.Ns,
+		diff.Change.RevID,
+		diff.Change.OldRevID,
+		diff.User,
+		diff.Comment,
+		diff.Size,
+		diff.Views,
+		unix(diff.Timestamp),
+		selectedAt.Unix(),
+		diff.DiffString,
+		diff.Review,
+		diff.ReviewPending,
+		string(change),
+		string(lines),
+		string(skipped),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error saving diff: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+func (db *DB) SetReview(ctx context.Context, id int64, review string) error {
+	res, err := db.ExecContext(ctx,
+		fmt.Sprintf("update %s set review = ?, review_pending = 0 where id = ?", db.diffsTable.Name()),
+		review, id,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving review: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return comparison.ErrNotFound
+	}
+	return nil
+}
+
+func (db *DB) AddWindow(ctx context.Context, id int64, window string, at time.Time) error {
+	return db.addWindow(ctx, db.DB, id, window, at)
+}
+
+func (db *DB) addWindow(ctx context.Context, ex execer, id int64, window string, at time.Time) error {
+	_, err := ex.ExecContext(ctx, db.windowsTable.Insert(), id, window, at.Unix(), at.Unix())
+	if err != nil {
+		return fmt.Errorf("error saving window %s of diff %d: %v", window, id, err)
+	}
+	return nil
+}
+
+func (db *DB) Get(ctx context.Context, id int64) (comparison.Comparison, error) {
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf("select %s from %s where id = ?", diffColumns, db.diffsTable.Name()),
+		id,
+	)
+	if err != nil {
+		return comparison.Comparison{}, err
+	}
+	comparisons, err := db.scan(ctx, rows)
+	if err != nil {
+		return comparison.Comparison{}, err
+	}
+	if len(comparisons) == 0 {
+		return comparison.Comparison{}, comparison.ErrNotFound
+	}
+	return comparisons[0], nil
+}
+
+func (db *DB) Since(ctx context.Context, wiki string, since time.Time) ([]comparison.Comparison, error) {
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf(
+			"select %s from %s where wiki = ? and selected_at >= ? order by selected_at, id",
+			diffColumns, db.diffsTable.Name(),
+		),
+		wiki, since.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return db.scan(ctx, rows)
+}
+
+// scan reads comparisons from rows selecting diffColumns and closes rows.
+func (db *DB) scan(ctx context.Context, rows *sql.Rows) ([]comparison.Comparison, error) {
+	defer rows.Close()
+	var comparisons []comparison.Comparison
+	for rows.Next() {
+		var (
+			c                      comparison.Comparison
+			editedAt, selectedAt   int64
+			bodyGz                 []byte
+			compactedAt            int64
+			change, lines, skipped string
+		)
+		err := rows.Scan(
+			&c.ID,
+			&c.Diff.Wiki,
+			&c.Diff.User,
+			&c.Diff.Comment,
+			&c.Diff.Size,
+			&c.Diff.Views,
+			&editedAt,
+			&selectedAt,
+			&c.Diff.DiffString,
+			&bodyGz,
+			&compactedAt,
+			&c.Diff.Review,
+			&c.Diff.ReviewPending,
+			&change,
+			&lines,
+			&skipped,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := errors.Join(
+			json.Unmarshal([]byte(change), &c.Diff.Change),
+			json.Unmarshal([]byte(lines), &c.Diff.Lines),
+			json.Unmarshal([]byte(skipped), &c.Diff.Skipped),
+		); err != nil {
+			return nil, fmt.Errorf("error decoding diff %d: %v", c.ID, err)
+		}
+		c.Diff.ID = c.ID
+		c.Compacted = compactedAt != 0
+		if bodyGz != nil {
+			if c.Diff.DiffString, err = gunzip(bodyGz); err != nil {
+				return nil, fmt.Errorf("error decompressing diff %d: %v", c.ID, err)
+			}
+		}
+		c.SelectedAt = time.Unix(selectedAt, 0)
+		if editedAt != 0 {
+			c.Diff.Timestamp = time.Unix(editedAt, 0).UTC()
+		}
+		comparisons = append(comparisons, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return comparisons, db.addWindows(ctx, comparisons)
+}
+
+// windowsBatch keeps the ids of one query below the variable limit of sqlite.
+const windowsBatch = 500
+
+// addWindows fills in the window membership of comparisons.
+func (db *DB) addWindows(ctx context.Context, comparisons []comparison.Comparison) error {
+	index := make(map[int64]int, len(comparisons))
+	for i, c := range comparisons {
+		index[c.ID] = i
+	}
+	for batch := range slices.Chunk(comparisons, windowsBatch) {
+		if err := db.addWindowsBatch(ctx, batch, comparisons, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) addWindowsBatch(
+	ctx context.Context,
+	batch []comparison.Comparison,
+	comparisons []comparison.Comparison,
+	index map[int64]int,
+) error {
+	args := make([]any, len(batch))
+	for i, c := range batch {
+		args[i] = c.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf(
+			"select diff_id, name from %s where diff_id in (%s) order by diff_id, first_at",
+			db.windowsTable.Name(), placeholders,
+		),
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		i := index[id]
+		comparisons[i].Windows = append(comparisons[i].Windows, name)
+	}
+	return rows.Err()
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"widiff/comparison"
+	"widiff/wiki"
+	wikiapi "widiff/wiki_api"
+)
+
+func testDb(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestInitIsIdempotent(t *testing.T) {
+	db := testDb(t)
+	if err := db.Init(); err != nil {
+		t.Errorf("second init failed: %s", err)
+	}
+	var version int
+	if err := db.QueryRow("pragma user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("wrong schema version, expected=%d, got=%d", len(migrations), version)
+	}
+}
+
+func TestRepositoryRoundTrip(t *testing.T) {
+	db := testDb(t)
+	ctx := context.Background()
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	diff := wikiapi.Diff{
+		Wiki:          "enwiki",
+		Timestamp:     t0.Add(-30 * time.Second),
+		DiffString:    "--- a\n+++ b\n+added\n",
+		Comment:       "expand",
+		User:          "Alice",
+		Size:          120,
+		ReviewPending: true,
+		Skipped:       []wikiapi.SkippedCandidate{{Title: "Huge", RevID: 9, Size: 900, Reason: "empty diff"}},
+		Change:        wiki.RecentChange{Title: "Go", PageID: 1, RevID: 11, OldRevID: 10, OldLen: 10, NewLen: 130, Tags: []string{"visualeditor"}},
+		Lines:         wikiapi.LineStats{Added: 1},
+		Views:         42,
+	}
+	id, err := db.Save(ctx, t0, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetReview(ctx, id, "great"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddWindow(ctx, id, "hour", t0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddWindow(ctx, id, "hour", t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddWindow(ctx, id, "day", t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := db.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := diff
+	expected.ID = id
+	expected.Review = "great"
+	expected.ReviewPending = false
+	if !reflect.DeepEqual(expected, actual.Diff) {
+		t.Errorf("wrong diff, expected=%+v, got=%+v", expected, actual.Diff)
+	}
+	if !actual.SelectedAt.Equal(t0) {
+		t.Errorf("wrong selection time, expected=%v, got=%v", t0, actual.SelectedAt)
+	}
+	if fmt.Sprint(actual.Windows) != "[hour day]" {
+		t.Errorf("wrong windows, expected=[hour day], got=%v", actual.Windows)
+	}
+
+	if _, err := db.Get(ctx, id+1); !errors.Is(err, comparison.ErrNotFound) {
+		t.Errorf("expected not found, got=%v", err)
+	}
+	if err := db.SetReview(ctx, id+1, "lost"); !errors.Is(err, comparison.ErrNotFound) {
+		t.Errorf("expected not found, got=%v", err)
+	}
+}
+
+func TestSince(t *testing.T) {
+	db := testDb(t)
+	ctx := context.Background()
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, wikiID := range []string{"enwiki", "dewiki", "enwiki", "enwiki"} {
+		diff := wikiapi.Diff{Wiki: wikiID, Size: i}
+		if _, err := db.Save(ctx, t0.Add(time.Duration(i)*time.Minute), diff); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := db.Since(ctx, "enwiki", t0.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, c := range stored {
+		sizes = append(sizes, c.Diff.Size)
+	}
+	if fmt.Sprint(sizes) != "[2 3]" {
+		t.Errorf("wrong diffs, expected=[2 3], got=%v", sizes)
+	}
+}
+
+func TestInTxRollsBack(t *testing.T) {
+	db := testDb(t)
+	ctx := context.Background()
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	failed := errors.New("crash before commit")
+	err := db.InTx(ctx, func(tx *Tx) error {
+		id, err := tx.Save(ctx, t0, wikiapi.Diff{Wiki: "enwiki", Size: 1})
+		if err != nil {
+			return err
+		}
+		if err := tx.AddWindow(ctx, id, "minute", t0); err != nil {
+			return err
+		}
+		if err := tx.SetCheckpoint(ctx, "job", t0); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("wrong error, expected=%v, got=%v", failed, err)
+	}
+
+	stored, err := db.Since(ctx, "enwiki", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("diff of rolled back transaction stored, got=%+v", stored)
+	}
+	if _, ok, err := db.Checkpoint(ctx, "job"); ok || err != nil {
+		t.Errorf("checkpoint of rolled back transaction stored, err=%v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention decides what Compact keeps of old diffs.
+type Retention struct {
+	// FullBodies is how long diffs keep their body as stored
+	FullBodies time.Duration
+	// KeepWindows are the windows whose winners keep a compressed body after
+	// FullBodies, every other diff is reduced to its metadata
+	KeepWindows []string
+}
+
+var DefaultRetention = Retention{
+	FullBodies:  30 * 24 * time.Hour,
+	KeepWindows: []string{"hour", "day"},
+}
+
+// CompactStats describes a compaction run.
+type CompactStats struct {
+	At         time.Time     `json:"at"`
+	Took       time.Duration `json:"took"`
+	Compressed int           `json:"compressed"`
+	Dropped    int           `json:"dropped"`
+	// Vacuumed is set when the file was rewritten to return freed pages
+	Vacuumed bool   `json:"vacuumed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// compactBatch bounds how many diffs one transaction compacts.
+const compactBatch = 200
+
+// Compact applies retention to the diffs selected before now minus
+// retention.FullBodies and vacuums the file if anything changed. Compressed
+// bodies stay in the search index, dropped ones leave it.
+func (db *DB) Compact(ctx context.Context, retention Retention, now time.Time) (stats CompactStats, err error) {
+	stats.At = now
+	start := time.Now()
+	defer func() { stats.Took = time.Since(start) }()
+
+	cutoff := now.Add(-retention.FullBodies).Unix()
+	for {
+		compressed, dropped, err := db.compactBatch(ctx, retention, cutoff, now)
+		stats.Compressed += compressed
+		stats.Dropped += dropped
+		if err != nil {
+			return stats, err
+		}
+		if compressed+dropped < compactBatch {
+			break
+		}
+	}
+
+	if stats.Compressed+stats.Dropped > 0 {
+		if _, err := db.ExecContext(ctx, "vacuum"); err != nil {
+			return stats, fmt.Errorf("error vacuuming: %v", err)
+		}
+		stats.Vacuumed = true
+	}
+	return stats, nil
+}
+
+func (db *DB) compactBatch(ctx context.Context, retention Retention, cutoff int64, now time.Time) (compressed, dropped int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// the winner check comes first in the statement, so do its arguments
+	keep := "0"
+	var args []any
+	if len(retention.KeepWindows) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(retention.KeepWindows)), ", ")
+		keep = fmt.Sprintf(
+			"exists (select 1 from %s w where w.diff_id = d.id and w.name in (%s))",
+			db.windowsTable.Name(), placeholders,
+		)
+		for _, window := range retention.KeepWindows {
+			args = append(args, window)
+		}
+	}
+	args = append(args, cutoff, compactBatch)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+		select d.id, d.body, %s
+		from %s d
+		where d.compacted_at = 0 and d.selected_at < ?
+		order by d.selected_at
+		limit ?`,
+		keep, db.diffsTable.Name(),
+	), args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	type candidate struct {
+		id     int64
+		body   string
+		winner bool
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.body, &c.winner); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	update := fmt.Sprintf(
+		"update %s set body = '', body_gz = ?, compacted_at = ? where id = ?",
+		db.diffsTable.Name(),
+	)
+	// the index keeps the tokens of the bodies that are kept compressed, the
+	// dropped ones are indexed again without body
+	unindex := fmt.Sprintf(`
+		update %s set title = d.title, comment = d.comment, body = '', review = d.review
+		from (select title, comment, review from %s where id = ?) d
+		where rowid = ?`,
+		db.searchTable.Name(), db.diffsTable.Name(),
+	)
+	for _, c := range candidates {
+		var bodyGz []byte
+		if c.winner {
+			if bodyGz, err = gzipString(c.body); err != nil {
+				return 0, 0, err
+			}
+			compressed++
+		} else {
+			dropped++
+			if db.fts {
+				if _, err := tx.ExecContext(ctx, unindex, c.id, c.id); err != nil {
+					return 0, 0, err
+				}
+			}
+		}
+		if _, err := tx.ExecContext(ctx, update, bodyGz, now.Unix(), c.id); err != nil {
+			return 0, 0, err
+		}
+	}
+	return compressed, dropped, tx.Commit()
+}
+
+func gzipString(s string) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := io.WriteString(w, s); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func gunzip(b []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	s, err := io.ReadAll(r)
+	return string(s), err
+}
+
+// Compactor runs Compact periodically and keeps the stats of the last run.
+type Compactor struct {
+	DB        *DB
+	Retention Retention
+	Interval  time.Duration
+
+	mu   sync.Mutex
+	last CompactStats
+	runs int
+}
+
+// Run compacts once right away and then every Interval until ctx is done.
+func (c *Compactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.RunOnce(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Compactor) RunOnce(ctx context.Context, now time.Time) CompactStats {
+	stats, err := c.DB.Compact(ctx, c.Retention, now)
+	if err != nil {
+		stats.Error = err.Error()
+		log.Printf("compaction failed: %s\n", err)
+	} else {
+		log.Printf("compressed %d bodies, dropped %d in %s\n", stats.Compressed, stats.Dropped, stats.Took)
+	}
+	c.mu.Lock()
+	c.last = stats
+	c.runs++
+	c.mu.Unlock()
+	return stats
+}
+
+// CompactorStatus is what the Compactor publishes, see expvar.
+type CompactorStatus struct {
+	Runs int          `json:"runs"`
+	Last CompactStats `json:"last"`
+}
+
+func (c *Compactor) Status() CompactorStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CompactorStatus{Runs: c.runs, Last: c.last}
+}
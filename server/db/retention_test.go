@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+	wikiapi "widiff/wiki_api"
+)
+
+func TestCompact(t *testing.T) {
+	db := testDb(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-40 * 24 * time.Hour)
+	body := "--- a\n+++ b\n+kept\n"
+
+	save := func(at time.Time, windows ...string) int64 {
+		t.Helper()
+		id, err := db.Save(ctx, at, wikiapi.Diff{Wiki: "enwiki", DiffString: body, Comment: "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, window := range windows {
+			if err := db.AddWindow(ctx, id, window, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return id
+	}
+	hourWinner := save(old, "minute", "hour")
+	dayWinner := save(old, "day")
+	minuteWinner := save(old, "minute")
+	recent := save(now.Add(-time.Hour))
+
+	compactor := &Compactor{DB: db, Retention: DefaultRetention}
+	stats := compactor.RunOnce(ctx, now)
+	if stats.Error != "" {
+		t.Fatal(stats.Error)
+	}
+	if stats.Compressed != 2 || stats.Dropped != 1 || !stats.Vacuumed {
+		t.Errorf("wrong stats, expected=2 compressed 1 dropped vacuumed, got=%+v", stats)
+	}
+
+	expected := map[int64]struct {
+		body      string
+		compacted bool
+	}{
+		hourWinner:   {body, true},
+		dayWinner:    {body, true},
+		minuteWinner: {"", true},
+		recent:       {body, false},
+	}
+	for id, e := range expected {
+		c, err := db.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Diff.DiffString != e.body || c.Compacted != e.compacted || c.Diff.Comment != "c" {
+			t.Errorf("wrong diff %d, expected body=%q compacted=%v, got body=%q compacted=%v",
+				id, e.body, e.compacted, c.Diff.DiffString, c.Compacted)
+		}
+	}
+
+	// nothing left to do, the file is left alone
+	stats = compactor.RunOnce(ctx, now)
+	if stats.Compressed+stats.Dropped != 0 || stats.Vacuumed {
+		t.Errorf("expected no-op, got=%+v", stats)
+	}
+	if status := compactor.Status(); status.Runs != 2 || status.Last.Vacuumed {
+		t.Errorf("wrong status, got=%+v", status)
+	}
+}
@@ -0,0 +1,308 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"widiff/comparison"
+)
+
+// SearchTable is an FTS5 index over the diffs table, kept in sync by
+// triggers. FTS5 needs the sqlite_fts5 build tag of go-sqlite3, without it
+// search falls back to LIKE.
+//
+// The index is contentless: it holds the tokens but no copy of the text, so
+// compressed bodies stay searchable without being stored uncompressed, see
+// Compact. Snippets are cut from the diffs instead.
+type SearchTable struct{}
+
+func (searchTable *SearchTable) Name() string {
+	return "diffs_index"
+}
+
+func (searchTable *SearchTable) Create() string {
+	return fmt.Sprintf(`
+	create virtual table if not exists %[1]s using fts5(
+		title, comment, body, review,
+		content = '', contentless_delete = 1
+	);
+
+	create trigger if not exists %[1]s_insert after insert on diffs begin
+		insert into %[1]s(rowid, title, comment, body, review)
+		values (new.id, new.title, new.comment, new.body, new.review);
+	end;
+
+	create trigger if not exists %[1]s_delete after delete on diffs begin
+		delete from %[1]s where rowid = old.id;
+	end;
+
+	-- a contentless index is updated with every column, a compressed body is
+	-- only in the index and compaction updates the index itself
+	create trigger if not exists %[1]s_update after update of title, comment, review on diffs
+	when new.body_gz is null begin
+		update %[1]s set title = new.title, comment = new.comment, body = new.body, review = new.review
+		where rowid = new.id;
+	end;
+	`, searchTable.Name())
+}
+
+func (searchTable *SearchTable) Insert() string {
+	// filled by the triggers, this indexes diffs stored before the index,
+	// see indexCompacted for the compressed ones
+	return fmt.Sprintf(`
+		insert into %s(rowid, title, comment, body, review)
+		select id, title, comment, body, review from diffs where body_gz is null`,
+		searchTable.Name(),
+	)
+}
+
+// legacySearch are the earlier search indexes: diffs_fts read the text from
+// diffs and lost the bodies of compacted diffs, diffs_search kept a copy of
+// every body.
+const legacySearch = `
+	drop trigger if exists diffs_fts_insert;
+	drop trigger if exists diffs_fts_delete;
+	drop trigger if exists diffs_fts_update;
+	drop table if exists diffs_fts;
+	drop trigger if exists diffs_search_insert;
+	drop trigger if exists diffs_search_delete;
+	drop trigger if exists diffs_search_update;
+	drop table if exists diffs_search;
+`
+
+// initSearch creates the search index if sqlite was built with FTS5.
+func (db *DB) initSearch() error {
+	var exists int
+	err := db.QueryRow(
+		"select count(*) from sqlite_master where name = ?",
+		db.searchTable.Name(),
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(db.searchTable.Create()); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			log.Printf("sqlite built without fts5, search falls back to LIKE\n")
+			return nil
+		}
+		return err
+	}
+	if exists == 0 {
+		if _, err := db.Exec(legacySearch); err != nil {
+			return err
+		}
+		if _, err := db.Exec(db.searchTable.Insert()); err != nil {
+			return err
+		}
+		if err := db.indexCompacted(); err != nil {
+			return err
+		}
+	}
+	db.fts = true
+	return nil
+}
+
+// indexCompacted indexes the diffs with compressed bodies, which Insert can
+// not read.
+func (db *DB) indexCompacted() error {
+	rows, err := db.Query(fmt.Sprintf(
+		"select id, title, comment, body_gz, review from %s where body_gz is not null", db.diffsTable.Name(),
+	))
+	if err != nil {
+		return err
+	}
+	type compacted struct {
+		id                           int64
+		title, comment, body, review string
+	}
+	var diffs []compacted
+	for rows.Next() {
+		var d compacted
+		var bodyGz []byte
+		if err := rows.Scan(&d.id, &d.title, &d.comment, &bodyGz, &d.review); err != nil {
+			rows.Close()
+			return err
+		}
+		if d.body, err = gunzip(bodyGz); err != nil {
+			rows.Close()
+			return fmt.Errorf("error decompressing diff %d: %v", d.id, err)
+		}
+		diffs = append(diffs, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf(
+		"insert into %s(rowid, title, comment, body, review) values (?, ?, ?, ?, ?)",
+		db.searchTable.Name(),
+	)
+	for _, d := range diffs {
+		if _, err := db.Exec(insert, d.id, d.title, d.comment, d.body, d.review); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ comparison.Searcher = (*DB)(nil)
+
+// snippet markers, replaced by <mark> after the snippet has been escaped
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+func (db *DB) Search(ctx context.Context, query comparison.SearchQuery) ([]comparison.SearchResult, error) {
+	terms := strings.Fields(query.Text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	var where []string
+	var args []any
+	if query.Wiki != "" {
+		where = append(where, "d.wiki = ?")
+		args = append(args, query.Wiki)
+	}
+	if !query.From.IsZero() {
+		where = append(where, "d.selected_at >= ?")
+		args = append(args, query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		where = append(where, "d.selected_at < ?")
+		args = append(args, query.To.Unix())
+	}
+
+	var stmt string
+	if db.fts {
+		stmt, args = db.ftsQuery(terms, where, args)
+	} else {
+		stmt, args = db.likeQuery(terms, where, args)
+	}
+	args = append(args, limit, max(query.Offset, 0))
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching diffs: %v", err)
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	results := make([]comparison.SearchResult, 0, len(ids))
+	for _, id := range ids {
+		c, err := db.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		// the contentless index has no text to cut snippets from
+		results = append(results, comparison.SearchResult{
+			Comparison: c,
+			Snippet:    highlight(likeSnippet(c, terms)),
+		})
+	}
+	return results, nil
+}
+
+// ftsQuery quotes every term, so user input can not use FTS5 syntax, and
+// ranks by bm25.
+func (db *DB) ftsQuery(terms []string, where []string, args []any) (string, []any) {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	where = append([]string{db.searchTable.Name() + " match ?"}, where...)
+	args = append([]any{strings.Join(quoted, " ")}, args...)
+	return fmt.Sprintf(`
+		select d.id
+		from %[1]s join %[2]s d on d.id = %[1]s.rowid
+		where %[3]s
+		order by rank
+		limit ? offset ?`,
+		db.searchTable.Name(), db.diffsTable.Name(), strings.Join(where, " and "),
+	), args
+}
+
+// likeQuery matches every term anywhere, newest first.
+func (db *DB) likeQuery(terms []string, where []string, args []any) (string, []any) {
+	for _, term := range terms {
+		where = append(where, `(d.title like ? escape '\' or d.comment like ? escape '\' `+
+			`or d.body like ? escape '\' or d.review like ? escape '\')`)
+		pattern := "%" + escapeLike(term) + "%"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	return fmt.Sprintf(`
+		select d.id
+		from %s d
+		where %s
+		order by d.selected_at desc, d.id desc
+		limit ? offset ?`,
+		db.diffsTable.Name(), strings.Join(where, " and "),
+	), args
+}
+
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// snippetContext is how many bytes around the first match likeSnippet keeps.
+const snippetContext = 60
+
+// likeSnippet cuts the first match of any term out of the searched fields
+// like snippet() of FTS5 would from stored text.
+func likeSnippet(c comparison.Comparison, terms []string) string {
+	for _, text := range []string{c.Diff.Change.Title, c.Diff.Comment, c.Diff.DiffString, c.Diff.Review} {
+		lower := strings.ToLower(text)
+		caseSensitive := len(lower) != len(text)
+		if caseSensitive {
+			// the offsets would not line up with text
+			lower = text
+		}
+		for _, term := range terms {
+			needle := strings.ToLower(term)
+			if caseSensitive {
+				needle = term
+			}
+			i := strings.Index(lower, needle)
+			if i < 0 {
+				continue
+			}
+			end := i + len(needle)
+			start := max(i-snippetContext, 0)
+			stop := min(end+snippetContext, len(text))
+			snippet := text[start:i] + markStart + text[i:end] + markEnd + text[end:stop]
+			if start > 0 {
+				snippet = "…" + snippet
+			}
+			if stop < len(text) {
+				snippet += "…"
+			}
+			return strings.ToValidUTF8(snippet, "")
+		}
+	}
+	return ""
+}
+
+// highlight escapes snippet for HTML and turns the markers into <mark>.
+func highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(escaped)
+}
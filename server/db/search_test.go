@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"widiff/comparison"
+	"widiff/wiki"
+	wikiapi "widiff/wiki_api"
+)
+
+func TestSearch(t *testing.T) {
+	db := testDb(t)
+	ctx := context.Background()
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	diffs := []wikiapi.Diff{
+		{Wiki: "enwiki", Change: wiki.RecentChange{Title: "Gopher"}, Comment: "rewrite", DiffString: "+The gopher is <small>"},
+		{Wiki: "enwiki", Change: wiki.RecentChange{Title: "Rust"}, Comment: "copyedit", Review: "a thorough gopher comparison"},
+		{Wiki: "dewiki", Change: wiki.RecentChange{Title: "Gopher"}, Comment: "neu"},
+		{Wiki: "enwiki", Change: wiki.RecentChange{Title: "Zig"}, Comment: "100% done"},
+	}
+	for i, diff := range diffs {
+		if _, err := db.Save(ctx, t0.Add(time.Duration(i)*time.Hour), diff); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// both the index and the fallback have to find the same diffs
+	modes := []bool{false}
+	if db.fts {
+		modes = append(modes, true)
+	}
+	for _, fts := range modes {
+		db.fts = fts
+
+		search := func(query comparison.SearchQuery) []string {
+			t.Helper()
+			results, err := db.Search(ctx, query)
+			if err != nil {
+				t.Fatalf("fts=%v: %s", fts, err)
+			}
+			var found []string
+			for _, r := range results {
+				found = append(found, r.Comparison.Diff.Wiki+":"+r.Comparison.Diff.Change.Title)
+			}
+			// the index ranks by relevance, the fallback by time
+			slices.Sort(found)
+			return found
+		}
+
+		tests := []struct {
+			query    comparison.SearchQuery
+			expected string
+		}{
+			{comparison.SearchQuery{Text: "gopher", Wiki: "enwiki"}, "[enwiki:Gopher enwiki:Rust]"},
+			{comparison.SearchQuery{Text: "gopher", To: t0.Add(30 * time.Minute)}, "[enwiki:Gopher]"},
+			{comparison.SearchQuery{Text: "gopher", From: t0.Add(90 * time.Minute)}, "[dewiki:Gopher]"},
+			{comparison.SearchQuery{Text: "gopher thorough"}, "[enwiki:Rust]"},
+			{comparison.SearchQuery{Text: "100% done"}, "[enwiki:Zig]"},
+			// FTS5 syntax is searched as text
+			{comparison.SearchQuery{Text: `NEAR("done`}, "[]"},
+			{comparison.SearchQuery{Text: "missing"}, "[]"},
+		}
+		for _, test := range tests {
+			actual := fmt.Sprint(search(test.query))
+			if test.expected != actual {
+				t.Errorf("fts=%v: wrong results for %+v, expected=%s, got=%s", fts, test.query, test.expected, actual)
+			}
+		}
+
+		results, err := db.Search(ctx, comparison.SearchQuery{Text: "small", Wiki: "enwiki"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Snippet == "" {
+			t.Fatalf("fts=%v: expected one result with snippet, got=%+v", fts, results)
+		}
+		snippet := results[0].Snippet
+		if !strings.Contains(snippet, "&lt;<mark>small</mark>&gt;") {
+			t.Errorf("fts=%v: snippet not escaped and highlighted, got=%q", fts, snippet)
+		}
+
+		// reviews arrive after the diff was stored
+		review := fmt.Sprintf("wombat%v", fts)
+		if err := db.SetReview(ctx, results[0].Comparison.ID, review); err != nil {
+			t.Fatal(err)
+		}
+		if found := search(comparison.SearchQuery{Text: review}); fmt.Sprint(found) != "[enwiki:Gopher]" {
+			t.Errorf("fts=%v: updated review not found, got=%v", fts, found)
+		}
+	}
+}
+
+func TestSearchAfterCompact(t *testing.T) {
+	db := testDb(t)
+	if !db.fts {
+		t.Skip("the LIKE fallback can not search compressed bodies, needs -tags sqlite_fts5")
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-40 * 24 * time.Hour)
+
+	winner, err := db.Save(ctx, old, wikiapi.Diff{Wiki: "enwiki", DiffString: "+the wombat stays"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddWindow(ctx, winner, "hour", old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Save(ctx, old, wikiapi.Diff{Wiki: "enwiki", DiffString: "+the quokka goes"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compact(ctx, DefaultRetention, now); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.Search(ctx, comparison.SearchQuery{Text: "wombat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Comparison.ID != winner || !strings.Contains(results[0].Snippet, "<mark>wombat</mark>") {
+		t.Errorf("compressed body not searchable, got=%+v", results)
+	}
+	results, err = db.Search(ctx, comparison.SearchQuery{Text: "quokka"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("dropped body still found, got=%+v", results)
+	}
+	// the index holds tokens only, a compressed body is not stored in clear
+	var copies int
+	err = db.QueryRow(
+		"select count(*) from sqlite_master where name = ?", db.searchTable.Name()+"_content",
+	).Scan(&copies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copies != 0 {
+		t.Errorf("index keeps a copy of the text")
+	}
+
+	// the index of an existing database is filled from the compressed bodies
+	if _, err := db.Exec("drop table " + db.searchTable.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.initSearch(); err != nil {
+		t.Fatal(err)
+	}
+	results, err = db.Search(ctx, comparison.SearchQuery{Text: "wombat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("compressed body not indexed on rebuild, got=%+v", results)
+	}
+}
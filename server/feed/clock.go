@@ -0,0 +1,190 @@
+package feed
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of a Feed, tests drive a FakeClock instead of
+// waiting for real time to pass.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	// WithTimeout is context.WithTimeout measured on this clock.
+	WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc)
+}
+
+// Ticker is the part of time.Ticker the feed uses.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the real time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, d)
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock only moves when Advance is called. Tickers and timeouts fire
+// during Advance, from the calling goroutine.
+type FakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	tickers  []*fakeTicker
+	timeouts []*fakeTimeout
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d. A ticker fires at most once per
+// Advance, a slow reader misses ticks like with time.Ticker.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	// Stop removes tickers in place while they fire
+	tickers := slices.Clone(c.tickers)
+	var expired []*fakeTimeout
+	pending := c.timeouts[:0]
+	for _, timeout := range c.timeouts {
+		if now.Before(timeout.deadline) {
+			pending = append(pending, timeout)
+		} else {
+			expired = append(expired, timeout)
+		}
+	}
+	c.timeouts = pending
+	c.mu.Unlock()
+
+	for _, ticker := range tickers {
+		ticker.fire(now)
+	}
+	for _, timeout := range expired {
+		timeout.cancel(context.DeadlineExceeded)
+	}
+}
+
+// Timeouts returns the number of timeouts that have not fired yet, tests use
+// it to wait for an update to start.
+func (c *FakeClock) Timeouts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timeouts)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ticker := &fakeTicker{
+		clock:  c,
+		period: d,
+		next:   c.now.Add(d),
+		c:      make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// WithTimeout returns a context that is cancelled once the clock has been
+// advanced past d, context.Cause reports context.DeadlineExceeded.
+func (c *FakeClock) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timeout := &fakeTimeout{deadline: c.now.Add(d), cancel: cancel}
+	c.timeouts = append(c.timeouts, timeout)
+	return ctx, func() {
+		c.remove(timeout)
+		cancel(context.Canceled)
+	}
+}
+
+func (c *FakeClock) remove(timeout *fakeTimeout) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t := range c.timeouts {
+		if t == timeout {
+			c.timeouts = append(c.timeouts[:i], c.timeouts[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTimeout struct {
+	deadline time.Time
+	cancel   context.CancelCauseFunc
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	period time.Duration
+	// next and stopped are guarded by clock.mu
+	next    time.Time
+	stopped bool
+	c       chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.stopped = true
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *fakeTicker) fire(now time.Time) {
+	t.clock.mu.Lock()
+	if t.stopped || now.Before(t.next) {
+		t.clock.mu.Unlock()
+		return
+	}
+	for !now.Before(t.next) {
+		t.next = t.next.Add(t.period)
+	}
+	t.clock.mu.Unlock()
+	select {
+	case t.c <- now:
+	default:
+	}
+}
@@ -0,0 +1,95 @@
+package feed
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFakeClockTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := clock.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock.Advance(59 * time.Second)
+	if ctx.Err() != nil {
+		t.Fatalf("timed out early at %s", clock.Now())
+	}
+	clock.Advance(time.Second)
+	if context.Cause(ctx) != context.DeadlineExceeded {
+		t.Errorf("wrong cause, expected=%v, got=%v", context.DeadlineExceeded, context.Cause(ctx))
+	}
+	if clock.Timeouts() != 0 {
+		t.Errorf("fired timeout still pending, got=%d", clock.Timeouts())
+	}
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+	ticker := clock.NewTicker(time.Minute)
+
+	clock.Advance(30 * time.Second)
+	select {
+	case at := <-ticker.C():
+		t.Fatalf("ticked early at %s", at)
+	default:
+	}
+
+	// one tick for several periods, the next one stays on the grid
+	clock.Advance(150 * time.Second)
+	if at := <-ticker.C(); !at.Equal(t0.Add(3 * time.Minute)) {
+		t.Errorf("wrong tick, expected=%s, got=%s", t0.Add(3*time.Minute), at)
+	}
+	clock.Advance(time.Minute)
+	if at := <-ticker.C(); !at.Equal(t0.Add(4 * time.Minute)) {
+		t.Errorf("wrong tick, expected=%s, got=%s", t0.Add(4*time.Minute), at)
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Hour)
+	select {
+	case at := <-ticker.C():
+		t.Errorf("stopped ticker ticked at %s", at)
+	default:
+	}
+}
+
+func TestFakeClockStopWhileAdvancing(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	tickers := make([]Ticker, 20)
+	for i := range tickers {
+		tickers[i] = clock.NewTicker(time.Minute)
+	}
+	live := clock.NewTicker(time.Minute)
+
+	// run with -race, Stop must not change the tickers Advance fires
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, ticker := range tickers {
+			ticker.Stop()
+		}
+	}()
+	clock.Advance(time.Minute)
+	wg.Wait()
+
+	if at := <-live.C(); !at.Equal(clock.Now()) {
+		t.Errorf("wrong tick, expected=%s, got=%s", clock.Now(), at)
+	}
+	clock.Advance(time.Minute)
+	for i, ticker := range tickers {
+		// drain the tick of the first Advance, if any
+		select {
+		case <-ticker.C():
+		default:
+		}
+		select {
+		case at := <-ticker.C():
+			t.Errorf("stopped ticker %d ticked at %s", i, at)
+		default:
+		}
+	}
+}
@@ -4,208 +4,612 @@ import (
 	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"slices"
+	"sync"
 	"time"
 	"widiff/assert"
+	"widiff/comparison"
 	"widiff/gem"
 	wikiapi "widiff/wiki_api"
 )
 
 type WikiSource interface {
-	TopDiff(startingFrom time.Time) (wikiapi.Diff, error)
+	TopDiff(ctx context.Context, startingFrom time.Time) (wikiapi.Diff, error)
 }
 
 type Generator interface {
 	Generate(context.Context, string) (string, error)
 }
 
+// DiffReviewer is a Generator that reviews the diff and its comment as they
+// are instead of the prompt built from them.
+type DiffReviewer interface {
+	ReviewDiff(ctx context.Context, diff, comment string) (string, error)
+}
+
+// Buffers hold the diffs of every timeframe by wall-clock time,
+// independent of how often the feed updates.
 type Buffers struct {
-	Minute Buffer[wikiapi.Diff]
-	Hour   Buffer[wikiapi.Diff]
-	Day    Buffer[wikiapi.Diff]
+	// Timeframes are sorted by duration
+	Timeframes []Timeframe
+	Windows    map[string]*Window[wikiapi.Diff]
 }
 
-func NewBuffers() *Buffers {
-	return &Buffers{
-		Minute: NewBuffer[wikiapi.Diff](1),
-		Hour:   NewBuffer[wikiapi.Diff](60),
-		Day:    NewBuffer[wikiapi.Diff](1440),
+// NewBuffers creates a window per timeframe, DefaultTimeframes if none are
+// given.
+func NewBuffers(timeframes ...Timeframe) *Buffers {
+	if len(timeframes) == 0 {
+		timeframes = DefaultTimeframes()
+	}
+	timeframes = slices.Clone(timeframes)
+	sortTimeframes(timeframes)
+	bs := &Buffers{
+		Timeframes: timeframes,
+		Windows:    make(map[string]*Window[wikiapi.Diff], len(timeframes)),
+	}
+	for _, t := range timeframes {
+		bs.Windows[t.Name] = NewWindow[wikiapi.Diff](t.Duration)
 	}
+	return bs
 }
 
-func (bs *Buffers) Report() Data {
-	maxMinute := maxDiff(bs.Minute.Items()...)
-	maxHour := maxDiff(bs.Hour.Items()...)
-	maxDay := maxDiff(bs.Day.Items()...)
+func (bs *Buffers) Report(now time.Time) Data {
+	data := Data{
+		Windows:      make(map[string]wikiapi.Diff, len(bs.Timeframes)),
+		Leaderboards: make(map[string][]wikiapi.Diff, len(bs.Timeframes)),
+	}
+	for i, t := range bs.Timeframes {
+		top := topDiffs(t.Ranker, t.topN(), bs.Windows[t.Name].Items(now)...)
+		largest := maxDiff(t.Ranker, top...)
+		log.Printf("largest diff %s=%d\n", t.Name, largest.Size)
+		data.Windows[t.Name] = largest
+		data.Leaderboards[t.Name] = top
 
-	log.Printf("largest diff minute=%d\n", maxMinute.Size)
-	log.Printf("largest diff hour=%d\n", maxHour.Size)
-	log.Printf("largest diff day=%d\n", maxDay.Size)
+		if i == 0 {
+			continue
+		}
+		// every diff of a shorter window is also in the longer one, so it can
+		// not outrank the longer window's maximum under its ranker
+		shorter := bs.Timeframes[i-1]
+		assert.Assert(
+			score(t.Ranker, data.Windows[shorter.Name]) <= score(t.Ranker, largest),
+			fmt.Sprintf("%s greater than %s", shorter.Name, t.Name),
+		)
+	}
+	return data
+}
 
-	assert.Assert(maxMinute.Size <= maxHour.Size, "minutely greater than hourly")
-	assert.Assert(maxHour.Size <= maxDay.Size, "hourly greater than daily")
+func (bs *Buffers) Update(at time.Time, diff wikiapi.Diff) {
+	for _, w := range bs.Windows {
+		w.Add(at, diff)
+	}
+}
 
-	return Data{
-		Minute: maxMinute,
-		Hour:   maxHour,
-		Day:    maxDay,
+// SetReview sets the review of the diff of revID recorded at the given
+// time, it reports false if the diff has left every window.
+func (bs *Buffers) SetReview(at time.Time, revID int, review string) bool {
+	found := false
+	for _, w := range bs.Windows {
+		w.Each(func(e *Entry[wikiapi.Diff]) {
+			if e.At.Equal(at) && e.Item.Change.RevID == revID {
+				e.Item.Review = review
+				e.Item.ReviewPending = false
+				found = true
+			}
+		})
 	}
+	return found
+}
+
+// Entries returns the entries of the longest window, which holds every
+// entry of the shorter ones.
+func (bs *Buffers) Entries(now time.Time) []Entry[wikiapi.Diff] {
+	longest := bs.Timeframes[len(bs.Timeframes)-1]
+	return slices.Clone(bs.Windows[longest.Name].Entries(now))
 }
 
-func (bs *Buffers) Update(diff wikiapi.Diff) {
-	bs.Minute.Write(diff)
-	bs.Hour.Write(diff)
-	bs.Day.Write(diff)
+// Warm fills the buffers from a snapshot and drops whatever fell out of its
+// window by now.
+func (bs *Buffers) Warm(now time.Time, entries []Entry[wikiapi.Diff]) {
+	for _, e := range entries {
+		bs.Update(e.At, e.Item)
+	}
+	for _, w := range bs.Windows {
+		w.Expire(now)
+	}
 }
 
+// Data holds the largest diff and the leaderboard of every timeframe of one
+// wiki.
 type Data struct {
-	Minute wikiapi.Diff
-	Hour   wikiapi.Diff
-	Day    wikiapi.Diff
+	Wiki    string
+	Windows map[string]wikiapi.Diff
+	// Leaderboards are ranked best first, one diff per page
+	Leaderboards map[string][]wikiapi.Diff
 }
 
 func (d Data) ToJson(w io.Writer) error {
 	diffs := Diffs{
-		Minute: Diff{
-			DiffString: d.Minute.DiffString,
-			Comment:    d.Minute.Comment,
-			User:       d.Minute.User,
-			Review:     d.Minute.Review,
-		},
-		Hour: Diff{
-			DiffString: d.Hour.DiffString,
-			Comment:    d.Hour.Comment,
-			User:       d.Hour.User,
-			Review:     d.Hour.Review,
-		},
-		Day: Diff{
-			DiffString: d.Day.DiffString,
-			Comment:    d.Day.Comment,
-			User:       d.Day.User,
-			Review:     d.Day.Review,
-		},
+		Wiki:         d.Wiki,
+		Windows:      make(map[string]Diff, len(d.Windows)),
+		Leaderboards: make(map[string][]Diff, len(d.Leaderboards)),
+	}
+	for name, diff := range d.Windows {
+		diffs.Windows[name] = ToJsonDiff(diff)
+	}
+	for name, top := range d.Leaderboards {
+		diffs.Leaderboards[name] = toJsonDiffs(top)
 	}
 	err := json.NewEncoder(w).Encode(diffs)
 	return err
 }
 
+// Leaderboard returns the first n entries of the leaderboard of window, all
+// of them if n is not positive.
+func (d Data) Leaderboard(window string, n int) (Leaderboard, bool) {
+	top, ok := d.Leaderboards[window]
+	if !ok {
+		return Leaderboard{}, false
+	}
+	if n > 0 && n < len(top) {
+		top = top[:n]
+	}
+	return Leaderboard{Wiki: d.Wiki, Window: window, Diffs: toJsonDiffs(top)}, true
+}
+
+type Leaderboard struct {
+	Wiki   string `json:"wiki"`
+	Window string `json:"window"`
+	Diffs  []Diff `json:"diffs"`
+}
+
+func toJsonDiffs(ds []wikiapi.Diff) []Diff {
+	diffs := make([]Diff, len(ds))
+	for i, d := range ds {
+		diffs[i] = ToJsonDiff(d)
+	}
+	return diffs
+}
+
+// ToJsonDiff converts a diff to the shape the frontend reads.
+func ToJsonDiff(d wikiapi.Diff) Diff {
+	var timestamp string
+	if !d.Timestamp.IsZero() {
+		timestamp = d.Timestamp.UTC().Format(time.RFC3339)
+	}
+	return Diff{
+		ID:            d.ID,
+		Wiki:          d.Wiki,
+		Title:         d.Change.Title,
+		RevID:         d.Change.RevID,
+		Size:          d.Size,
+		Timestamp:     timestamp,
+		DiffString:    d.DiffString,
+		Comment:       d.Comment,
+		User:          d.User,
+		Review:        d.Review,
+		ReviewPending: d.ReviewPending,
+		Skipped:       d.Skipped,
+	}
+}
+
 type Diffs struct {
-	Minute Diff `json:"minute"`
-	Hour   Diff `json:"hour"`
-	Day    Diff `json:"day"`
+	Wiki         string            `json:"wiki"`
+	Windows      map[string]Diff   `json:"windows"`
+	Leaderboards map[string][]Diff `json:"leaderboards"`
 }
 
 type Diff struct {
+	ID         int64  `json:"id,omitempty"`
+	Wiki       string `json:"wiki"`
+	Title      string `json:"title,omitempty"`
+	RevID      int    `json:"revid,omitempty"`
+	Size       int    `json:"size"`
+	Timestamp  string `json:"timestamp,omitempty"`
 	DiffString string `json:"diffstring"`
 	Comment    string `json:"comment"`
 	User       string `json:"user"`
 	Review     string `json:"review"`
+	// ReviewPending is set until the review is pushed in a later report
+	ReviewPending bool                       `json:"review_pending,omitempty"`
+	Skipped       []wikiapi.SkippedCandidate `json:"skipped,omitempty"`
 }
 
 type Feed struct {
-	Source    WikiSource
+	// Sources holds one source per wiki id, each gets its own buffers
+	Sources map[string]WikiSource
+	// Clock is the time the feed runs on, set it before Start
+	Clock     Clock
 	push      chan Data
-	stop      chan struct{}
 	generator Generator
+	// timeframes are reported for every wiki
+	timeframes []Timeframe
+	// repo stores every selected diff, nil keeps them in memory only
+	repo comparison.Repository
+	// snapshots keep the buffers across restarts, may be nil
+	snapshots    Snapshotter
+	lastSnapshot time.Time
+	updateEvery  time.Duration
+	// updateTimeout bounds fetching the top diff of a wiki
+	updateTimeout time.Duration
+	// ReviewTimeout bounds a single review, set it before Start
+	ReviewTimeout time.Duration
+	// ReviewWorkers is how many reviews run at once, set it before Start
+	ReviewWorkers int
+	// reviews queues the diffs to review, reviewed returns the results to
+	// the loop, which owns the buffers
+	reviews  chan reviewJob
+	reviewed chan reviewResult
+	workers  sync.WaitGroup
+	// ctx is cancelled by Stop and aborts in-flight updates
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mu guards starting and stopping, done is closed once the loop of the
+	// last Start returned
+	mu   sync.Mutex
+	done chan struct{}
+	// inflight counts fetches, which may outlive their update on timeout
+	inflight sync.WaitGroup
 }
 
+var ErrRunning = errors.New("feed is already running")
+
+// Pull returns the channel the reports are pushed on. Stop closes it, a
+// restarted feed pushes on a new channel.
 func (f *Feed) Pull() chan Data {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return f.push
 }
 
-func New(source WikiSource, updateEvery time.Duration, generator Generator) *Feed {
-	f := &Feed{Source: source}
-	f.initStream(updateEvery)
+func New(
+	sources map[string]WikiSource,
+	updateEvery time.Duration,
+	generator Generator,
+	timeframes []Timeframe,
+	repo comparison.Repository,
+	snapshots Snapshotter,
+) *Feed {
+	f := &Feed{Sources: sources, Clock: SystemClock}
 	f.push = make(chan Data, 1)
 	f.generator = generator
+	f.timeframes = timeframes
+	f.repo = repo
+	f.snapshots = snapshots
+	if snapshots == nil && repo != nil {
+		f.snapshots = RepositorySnapshotter{
+			Repo:  repo,
+			Wikis: slices.Collect(maps.Keys(sources)),
+		}
+	}
+	f.updateEvery = updateEvery
+	f.updateTimeout = 10 * time.Second
+	f.ReviewTimeout = DefaultReviewTimeout
+	f.ReviewWorkers = DefaultReviewWorkers
 	return f
 }
 
-// TODO: implement corresponding Start method
+// Start runs the update loop until ctx is done or Stop is called. The
+// buffers are warmed from the last snapshot before the first report.
+func (f *Feed) Start(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done != nil {
+		select {
+		case <-f.done:
+			// the previous run closed its channel
+			f.push = make(chan Data, 1)
+		default:
+			return ErrRunning
+		}
+	}
+	if rs, ok := f.snapshots.(RepositorySnapshotter); ok && rs.Clock == nil {
+		rs.Clock = f.Clock
+		f.snapshots = rs
+	}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	f.done = make(chan struct{})
+	f.reviews = make(chan reviewJob, ReviewQueueSize)
+	f.reviewed = make(chan reviewResult)
+	for range max(f.ReviewWorkers, 1) {
+		f.workers.Add(1)
+		go f.reviewWorker(f.reviews)
+	}
+	go f.run(f.push, f.done)
+	return nil
+}
+
+// Stop cancels in-flight updates, waits for them to return, takes a final
+// snapshot and closes the Pull channel. It is safe to call more than once.
 func (f *Feed) Stop() {
-	close(f.stop)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done == nil {
+		return
+	}
+	f.cancel()
+	<-f.done
 }
 
 func Test(source WikiSource) *Feed {
 	feed := New(
-		source,
+		map[string]WikiSource{"enwiki": source},
 		time.Duration(10*time.Second),
 		gem.Test(),
+		DefaultTimeframes(),
+		nil,
+		nil,
 	)
+	feed.Start(context.Background())
 	return feed
 }
 
-// TODO: pass ctx to wiki requests
-func (f *Feed) initStream(interval time.Duration) {
-	buffs := NewBuffers()
-	ticker := time.NewTicker(interval)
-	go func() {
-		// populate feed with initial value
-		f.updateBuffers(buffs)
-		f.push <- buffs.Report()
-		for {
-			select {
-			case <-f.stop:
-				return
-			case <-ticker.C:
-				f.updateBuffers(buffs)
-				f.push <- buffs.Report()
+func (f *Feed) run(push chan Data, done chan struct{}) {
+	defer close(done)
+	defer close(push)
+
+	buffs := make(map[string]*Buffers, len(f.Sources))
+	for wiki := range f.Sources {
+		buffs[wiki] = NewBuffers(f.timeframes...)
+	}
+	ticker := f.Clock.NewTicker(f.updateEvery)
+	defer ticker.Stop()
+
+	f.restore(buffs)
+	// populate feed with initial value
+	f.updateAll(buffs)
+	for {
+		select {
+		case <-f.ctx.Done():
+			f.inflight.Wait()
+			f.workers.Wait()
+			// f.ctx is done, the final snapshot gets a context of its own
+			ctx, cancel := context.WithTimeout(context.Background(), f.updateTimeout)
+			f.snapshot(ctx, buffs)
+			cancel()
+			return
+		case <-ticker.C():
+			f.updateAll(buffs)
+			if f.Clock.Now().Sub(f.lastSnapshot) >= SnapshotInterval {
+				f.snapshot(f.ctx, buffs)
 			}
+		case result := <-f.reviewed:
+			f.applyReview(buffs, result)
 		}
-	}()
+	}
+}
+
+// updateAll updates the buffers of every wiki concurrently and pushes one
+// report per wiki.
+func (f *Feed) updateAll(buffs map[string]*Buffers) {
+	var wg sync.WaitGroup
+	for wiki, source := range f.Sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.updateBuffers(wiki, source, buffs[wiki])
+		}()
+	}
+	wg.Wait()
+
+	for _, wiki := range slices.Sorted(maps.Keys(buffs)) {
+		now := f.Clock.Now()
+		data := buffs[wiki].Report(now)
+		data.Wiki = wiki
+		f.saveWindows(data, now)
+		if !f.publish(data) {
+			return
+		}
+	}
 }
 
-func (f *Feed) updateBuffers(buffs *Buffers) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// publish pushes data unless the feed is stopping.
+func (f *Feed) publish(data Data) bool {
+	select {
+	case f.push <- data:
+		return true
+	case <-f.ctx.Done():
+		return false
+	}
+}
+
+// updateBuffers only writes to buffs from the calling goroutine, so a fetch
+// that is still running after the timeout can never write a stale result.
+func (f *Feed) updateBuffers(wiki string, source WikiSource, buffs *Buffers) {
+	ctx, cancel := f.Clock.WithTimeout(f.ctx, f.updateTimeout)
 	defer cancel()
-	done := make(chan struct{})
+	result := make(chan wikiapi.Diff, 1)
+	f.inflight.Add(1)
 	go func() {
-		var newTopDiff wikiapi.Diff
-		newTopDiff, err := f.fetchDiff()
+		defer f.inflight.Done()
+		defer close(result)
+		newTopDiff, err := f.fetchDiff(ctx, source)
 		if err != nil {
-			log.Println(err)
-			buffs.Update(newTopDiff)
-		} else {
-			review, err := f.judgeDiff(ctx, newTopDiff)
-			if err == nil {
-				newTopDiff.Review = review
-			} else {
-				log.Printf("error judging diff: %s\n", err)
-			}
-			buffs.Update(newTopDiff)
+			// the windows are time based, a failed update leaves no gap to fill
+			logFetchError(err)
+			return
 		}
-		done <- struct{}{}
+		result <- newTopDiff
 	}()
 
 	select {
-	case <-done:
+	case newTopDiff, ok := <-result:
+		// both cases may be ready, a stopping feed must not save the result
+		if ok && ctx.Err() == nil {
+			now := f.Clock.Now()
+			newTopDiff.ReviewPending = true
+			f.save(now, &newTopDiff)
+			buffs.Update(now, newTopDiff)
+			f.queueReview(wiki, buffs, now, newTopDiff)
+		}
 	case <-ctx.Done():
-		log.Println("feed update timed out")
+		log.Printf("feed update aborted: %s\n", context.Cause(ctx))
+	}
+}
+
+// restore warms buffs from the last snapshot before the first report, so a
+// restart keeps the hour and day views.
+func (f *Feed) restore(buffs map[string]*Buffers) {
+	now := f.Clock.Now()
+	f.lastSnapshot = now
+	if f.snapshots == nil {
+		return
+	}
+	var longest time.Duration
+	for _, t := range f.timeframes {
+		longest = max(longest, t.Duration)
+	}
+	snapshot, err := f.snapshots.LoadSnapshot(f.ctx, now.Add(-longest))
+	if err != nil {
+		log.Printf("could not load snapshot: %s\n", err)
+		return
+	}
+	for wiki, bs := range buffs {
+		entries := snapshot.Wikis[wiki]
+		bs.Warm(now, entries)
+		log.Printf("restored %d %s diffs\n", len(entries), wiki)
+		// reviews queued before the restart were lost with the queue
+		for _, e := range bs.Entries(now) {
+			if e.Item.ReviewPending {
+				f.queueReview(wiki, bs, e.At, e.Item)
+			}
+		}
 	}
 }
 
-func (f *Feed) fetchDiff() (wikiapi.Diff, error) {
-	startingFrom := time.Now().Add(-1 * time.Minute).Add(-10 * time.Second)
-	newTopDiff, err := f.Source.TopDiff(startingFrom)
+func (f *Feed) snapshot(ctx context.Context, buffs map[string]*Buffers) {
+	if f.snapshots == nil {
+		return
+	}
+	now := f.Clock.Now()
+	snapshot := Snapshot{
+		TakenAt: now,
+		Wikis:   make(map[string][]Entry[wikiapi.Diff], len(buffs)),
+	}
+	for wiki, bs := range buffs {
+		snapshot.Wikis[wiki] = bs.Entries(now)
+	}
+	if err := f.snapshots.SaveSnapshot(ctx, snapshot); err != nil {
+		log.Printf("could not save snapshot: %s\n", err)
+		return
+	}
+	f.lastSnapshot = now
+}
+
+// save stores a selected diff and sets its ID.
+func (f *Feed) save(at time.Time, diff *wikiapi.Diff) {
+	if f.repo == nil {
+		return
+	}
+	id, err := f.repo.Save(f.ctx, at, *diff)
+	if err != nil {
+		log.Printf("could not store diff: %s\n", err)
+		return
+	}
+	diff.ID = id
+}
+
+// saveWindows records which stored diffs were reported as the largest of
+// their window.
+func (f *Feed) saveWindows(data Data, at time.Time) {
+	if f.repo == nil {
+		return
+	}
+	if err := SaveWindows(f.ctx, f.repo, data, at); err != nil {
+		log.Printf("could not store window: %s\n", err)
+	}
+}
+
+// SaveWindows records the stored diffs of data as the largest of their
+// window at the time of the report.
+func SaveWindows(ctx context.Context, repo comparison.WindowRecorder, data Data, at time.Time) error {
+	for window, diff := range data.Windows {
+		if diff.ID == 0 {
+			continue
+		}
+		if err := repo.AddWindow(ctx, diff.ID, window, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookback is how far back each update looks for changes, a little more
+// than the update interval so no edit falls between two updates.
+const Lookback = 1*time.Minute + 10*time.Second
+
+func (f *Feed) fetchDiff(ctx context.Context, source WikiSource) (wikiapi.Diff, error) {
+	startingFrom := f.Clock.Now().Add(-Lookback)
+	newTopDiff, err := source.TopDiff(ctx, startingFrom)
 	return newTopDiff, err
 }
 
+// logFetchError keeps the raw response of a failed fetch for diagnostics.
+func logFetchError(err error) {
+	if body := wikiapi.RawBody(err); body != nil {
+		log.Printf("could not fetch top diff: %s\nraw body: %.2000s\n", err, body)
+		return
+	}
+	log.Printf("could not fetch top diff: %s\n", err)
+}
+
 func (f *Feed) judgeDiff(ctx context.Context, diff wikiapi.Diff) (string, error) {
+	if reviewer, ok := f.generator.(DiffReviewer); ok {
+		return reviewer.ReviewDiff(ctx, diff.DiffString, diff.Comment)
+	}
 	prompt := buildPrompt(diff.DiffString, diff.Comment)
 	judged, err := f.generator.Generate(ctx, prompt)
 	return judged, err
 }
 
-func maxDiff(diffs ...wikiapi.Diff) wikiapi.Diff {
+func maxDiff(ranker wikiapi.Ranker, diffs ...wikiapi.Diff) wikiapi.Diff {
+	if len(diffs) == 0 {
+		return wikiapi.Diff{}
+	}
 	longest := slices.MaxFunc(diffs, func(a, b wikiapi.Diff) int {
-		return cmp.Compare(a.Size, b.Size)
+		return cmp.Compare(score(ranker, a), score(ranker, b))
 	})
 	return longest
 }
 
+// topDiffs ranks diffs best first and keeps the best diff of every page, so
+// a page picked in consecutive updates does not crowd out the runners-up.
+// Diffs without a title can not be told apart and are all kept.
+func topDiffs(ranker wikiapi.Ranker, n int, diffs ...wikiapi.Diff) []wikiapi.Diff {
+	ranked := slices.Clone(diffs)
+	slices.SortStableFunc(ranked, func(a, b wikiapi.Diff) int {
+		return cmp.Compare(score(ranker, b), score(ranker, a))
+	})
+
+	top := make([]wikiapi.Diff, 0, min(n, len(ranked)))
+	seen := make(map[string]bool)
+	for _, diff := range ranked {
+		if len(top) == n {
+			break
+		}
+		if page := diff.Wiki + ":" + diff.Change.Title; diff.Change.Title != "" {
+			if seen[page] {
+				continue
+			}
+			seen[page] = true
+		}
+		top = append(top, diff)
+	}
+	return top
+}
+
+func score(ranker wikiapi.Ranker, diff wikiapi.Diff) float64 {
+	if ranker == nil {
+		return float64(diff.Size)
+	}
+	return ranker.Score(diff.Candidate())
+}
+
 func buildPrompt(diff, comment string) string {
 	return diff + fmt.Sprintf("\ncomment: %s", comment)
 }
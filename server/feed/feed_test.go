@@ -1,11 +1,17 @@
 package feed
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime"
+	"slices"
 	"testing"
 	"time"
+	"widiff/comparison"
 	"widiff/gem"
+	"widiff/wiki"
 	"widiff/wiki_api"
 )
 
@@ -13,7 +19,7 @@ type testWikiApi struct {
 	counter int
 }
 
-func (twa *testWikiApi) TopDiff(s time.Time) (wiki_api.Diff, error) {
+func (twa *testWikiApi) TopDiff(ctx context.Context, s time.Time) (wiki_api.Diff, error) {
 	twa.counter++
 	return wiki_api.Diff{Size: twa.counter}, nil
 }
@@ -21,28 +27,505 @@ func (twa *testWikiApi) TopDiff(s time.Time) (wiki_api.Diff, error) {
 func TestMaxValues(t *testing.T) {
 	buffs := NewBuffers()
 
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	at := t0
 	baseLine := 240
 	for range 24 {
-		f := New(&testWikiApi{counter: baseLine}, 100*time.Millisecond, gem.Test())
+		f := &Feed{Clock: NewFakeClock(at)}
+		source := &testWikiApi{counter: baseLine}
 		for range 1 * 60 {
-			newTopDiff, _ := f.fetchDiff()
-			buffs.Update(newTopDiff)
+			newTopDiff, _ := f.fetchDiff(context.Background(), source)
+			buffs.Update(at, newTopDiff)
+			at = at.Add(time.Minute)
 		}
 		baseLine -= 10
 	}
 
-	actual := buffs.Report()
-	expected := Data{
-		Minute: wiki_api.Diff{Size: 60},
-		Hour:   wiki_api.Diff{Size: 60},
-		Day:    wiki_api.Diff{Size: 160},
+	now := at.Add(-time.Minute)
+	actual := buffs.Report(now)
+	expected := Data{Windows: map[string]wiki_api.Diff{
+		"minute": {Size: 70},
+		"hour":   {Size: 70},
+		"day":    {Size: 300},
+	}}
+
+	fmt.Printf("Minute:\n, %v\n", buffs.Windows["minute"].Items(now))
+	fmt.Printf("Hour:\n, %v\n", buffs.Windows["hour"].Items(now))
+	fmt.Printf("Day:\n, %v\n", buffs.Windows["day"].Items(now))
+
+	if !reflect.DeepEqual(expected.Windows, actual.Windows) {
+		t.Errorf("wrong report data, expected=%+v, got=%+v", expected.Windows, actual.Windows)
+	}
+}
+
+var emptyData = Data{Windows: map[string]wiki_api.Diff{
+	"minute": {},
+	"hour":   {},
+	"day":    {},
+}}
+
+func TestCustomTimeframes(t *testing.T) {
+	timeframes, err := ParseTimeframes("week,5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffs := NewBuffers(timeframes...)
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	buffs.Update(t0, wiki_api.Diff{Size: 500})
+	buffs.Update(t0.Add(3*24*time.Hour), wiki_api.Diff{Size: 1})
+
+	actual := buffs.Report(t0.Add(3*24*time.Hour + 4*time.Minute))
+	expected := Data{Windows: map[string]wiki_api.Diff{
+		"5m":   {Size: 1},
+		"week": {Size: 500},
+	}}
+	if !reflect.DeepEqual(expected.Windows, actual.Windows) {
+		t.Errorf("wrong report data, expected=%+v, got=%+v", expected.Windows, actual.Windows)
+	}
+}
+
+func TestWindowsExpireByTime(t *testing.T) {
+	buffs := NewBuffers()
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// a two hour outage must not stretch the hour window
+	buffs.Update(t0, wiki_api.Diff{Size: 500})
+	buffs.Update(t0.Add(2*time.Hour), wiki_api.Diff{Size: 1})
+
+	actual := buffs.Report(t0.Add(2 * time.Hour))
+	expected := Data{Windows: map[string]wiki_api.Diff{
+		"minute": {Size: 1},
+		"hour":   {Size: 1},
+		"day":    {Size: 500},
+	}}
+	if !reflect.DeepEqual(expected.Windows, actual.Windows) {
+		t.Errorf("wrong report data, expected=%+v, got=%+v", expected.Windows, actual.Windows)
+	}
+
+	actual = buffs.Report(t0.Add(26 * time.Hour))
+	if !reflect.DeepEqual(emptyData.Windows, actual.Windows) {
+		t.Errorf("expired diffs reported, expected=%+v, got=%+v", emptyData.Windows, actual.Windows)
+	}
+}
+
+func TestLeaderboardDedupsPages(t *testing.T) {
+	buffs := NewBuffers(Timeframe{Name: "hour", Duration: time.Hour, TopN: 3})
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	edits := []struct {
+		title string
+		revID int
+		size  int
+	}{
+		{"Go", 1, 100},
+		{"Go", 1, 100}, // same revision picked again by the next update
+		{"Go", 2, 300},
+		{"Rust", 3, 200},
+		{"Zig", 4, 50},
+		{"C", 5, 10},
+	}
+	for i, e := range edits {
+		buffs.Update(t0.Add(time.Duration(i)*time.Minute), wiki_api.Diff{
+			Size:   e.size,
+			Change: wiki.RecentChange{Title: e.title, RevID: e.revID},
+		})
+	}
+
+	data := buffs.Report(t0.Add(10 * time.Minute))
+	board, ok := data.Leaderboard("hour", 0)
+	if !ok {
+		t.Fatalf("no leaderboard for hour")
+	}
+	var actual []string
+	for _, d := range board.Diffs {
+		actual = append(actual, fmt.Sprintf("%s@%d=%d", d.Title, d.RevID, d.Size))
+	}
+	expected := []string{"Go@2=300", "Rust@3=200", "Zig@4=50"}
+	if fmt.Sprint(expected) != fmt.Sprint(actual) {
+		t.Errorf("wrong leaderboard, expected=%v, got=%v", expected, actual)
+	}
+
+	board, _ = data.Leaderboard("hour", 1)
+	if len(board.Diffs) != 1 || board.Diffs[0].Title != "Go" {
+		t.Errorf("leaderboard not truncated, expected=[Go], got=%v", board.Diffs)
+	}
+	if _, ok := data.Leaderboard("week", 0); ok {
+		t.Errorf("expected no leaderboard for unconfigured window")
+	}
+}
+
+type memoryRepository struct {
+	stored  []comparison.Comparison
+	windows map[int64][]string
+}
+
+func (r *memoryRepository) Save(ctx context.Context, selectedAt time.Time, diff wiki_api.Diff) (int64, error) {
+	id := int64(len(r.stored) + 1)
+	diff.ID = id
+	r.stored = append(r.stored, comparison.Comparison{ID: id, SelectedAt: selectedAt, Diff: diff})
+	return id, nil
+}
+
+func (r *memoryRepository) SetReview(ctx context.Context, id int64, review string) error {
+	r.stored[id-1].Diff.Review = review
+	return nil
+}
+
+func (r *memoryRepository) AddWindow(ctx context.Context, id int64, window string, at time.Time) error {
+	if r.windows == nil {
+		r.windows = make(map[int64][]string)
+	}
+	if !slices.Contains(r.windows[id], window) {
+		r.windows[id] = append(r.windows[id], window)
+	}
+	return nil
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id int64) (comparison.Comparison, error) {
+	return r.stored[id-1], nil
+}
+
+func (r *memoryRepository) Since(ctx context.Context, wiki string, since time.Time) ([]comparison.Comparison, error) {
+	var found []comparison.Comparison
+	for _, c := range r.stored {
+		if c.Diff.Wiki == wiki && !c.SelectedAt.Before(since) {
+			found = append(found, c)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryRepository) List(ctx context.Context, query comparison.Query) (comparison.Page, error) {
+	return comparison.Page{}, errors.New("not implemented")
+}
+
+func TestRestoreFromRepository(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	repo := &memoryRepository{}
+	repo.Save(context.Background(), now.Add(-25*time.Hour), wiki_api.Diff{Wiki: "enwiki", Size: 900})
+	repo.Save(context.Background(), now.Add(-2*time.Hour), wiki_api.Diff{Wiki: "enwiki", Size: 300})
+	repo.Save(context.Background(), now.Add(-30*time.Minute), wiki_api.Diff{Wiki: "enwiki", Size: 100})
+	repo.Save(context.Background(), now.Add(-30*time.Minute), wiki_api.Diff{Wiki: "dewiki", Size: 500})
+
+	f := &Feed{
+		timeframes: DefaultTimeframes(),
+		repo:       repo,
+		snapshots:  RepositorySnapshotter{Repo: repo, Wikis: []string{"enwiki"}, Clock: clock},
+		Clock:      clock,
+		ctx:        context.Background(),
+	}
+	buffs := map[string]*Buffers{"enwiki": NewBuffers(f.timeframes...)}
+	f.restore(buffs)
+
+	snapshot, err := f.snapshots.LoadSnapshot(context.Background(), now.Add(-time.Hour))
+	if err != nil || !snapshot.TakenAt.Equal(now) {
+		t.Errorf("snapshot not taken on the feed clock, expected=%s, got=%s (%v)", now, snapshot.TakenAt, err)
+	}
+
+	actual := buffs["enwiki"].Report(now)
+	expected := map[string]int{"minute": 0, "hour": 100, "day": 300}
+	for window, size := range expected {
+		if actual.Windows[window].Size != size {
+			t.Errorf("wrong %s diff, expected=%d, got=%d", window, size, actual.Windows[window].Size)
+		}
+	}
+}
+
+func TestStartSetsSnapshotClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	f := New(map[string]WikiSource{"enwiki": &testWikiApi{}}, time.Minute, gem.Test(), nil, &memoryRepository{}, nil)
+	f.Clock = clock
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.Stop()
+
+	if rs, ok := f.snapshots.(RepositorySnapshotter); !ok || rs.Clock != clock {
+		t.Errorf("repository snapshots not on the feed clock, got=%+v", f.snapshots)
+	}
+}
+
+func TestUpdateSavesDiffAndWindows(t *testing.T) {
+	repo := &memoryRepository{}
+	f := &Feed{
+		generator:     gem.Test(),
+		updateTimeout: time.Second,
+		timeframes:    DefaultTimeframes(),
+		repo:          repo,
+		Clock:         NewFakeClock(time.Now()),
+		ctx:           context.Background(),
+		push:          make(chan Data, 1),
+		Sources:       map[string]WikiSource{"enwiki": &testWikiApi{counter: 41}},
+	}
+	buffs := map[string]*Buffers{"enwiki": NewBuffers(f.timeframes...)}
+
+	f.updateAll(buffs)
+	data := <-f.push
+
+	if len(repo.stored) != 1 || repo.stored[0].Diff.Size != 42 {
+		t.Fatalf("diff not stored, got=%+v", repo.stored)
+	}
+	if data.Windows["hour"].ID != 1 {
+		t.Errorf("reported diff without id, expected=1, got=%d", data.Windows["hour"].ID)
+	}
+	expected := []string{"day", "hour", "minute"}
+	actual := slices.Sorted(slices.Values(repo.windows[1]))
+	if fmt.Sprint(expected) != fmt.Sprint(actual) {
+		t.Errorf("wrong windows, expected=%v, got=%v", expected, actual)
+	}
+}
+
+type slowWikiApi struct {
+	started  chan struct{}
+	returned chan struct{}
+}
+
+func (swa *slowWikiApi) TopDiff(ctx context.Context, s time.Time) (wiki_api.Diff, error) {
+	defer close(swa.returned)
+	close(swa.started)
+	<-ctx.Done()
+	return wiki_api.Diff{Size: 99}, ctx.Err()
+}
+
+func TestUpdateTimeoutDiscardsResult(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	f := &Feed{
+		generator:     gem.Test(),
+		updateTimeout: 10 * time.Second,
+		Clock:         clock,
+		ctx:           context.Background(),
+	}
+	buffs := NewBuffers()
+	source := &slowWikiApi{started: make(chan struct{}), returned: make(chan struct{})}
+
+	go func() {
+		<-source.started
+		clock.Advance(f.updateTimeout)
+	}()
+	f.updateBuffers("enwiki", source, buffs)
+	<-source.returned
+
+	actual := buffs.Report(clock.Now())
+	if !reflect.DeepEqual(emptyData.Windows, actual.Windows) {
+		t.Errorf("stale diff written, expected=%+v, got=%+v", emptyData.Windows, actual.Windows)
+	}
+}
+
+func TestUpdateAfterStopDiscardsResult(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	repo := &memoryRepository{}
+	f := &Feed{
+		generator:     gem.Test(),
+		updateTimeout: time.Second,
+		repo:          repo,
+		Clock:         NewFakeClock(time.Now()),
+		ctx:           ctx,
+	}
+	buffs := NewBuffers()
+
+	// the source ignores ctx, its result is ready along with ctx.Done
+	f.updateBuffers("enwiki", &testWikiApi{}, buffs)
+
+	if actual := buffs.Report(f.Clock.Now()); !reflect.DeepEqual(emptyData.Windows, actual.Windows) {
+		t.Errorf("result of stopped feed written, expected=%+v, got=%+v", emptyData.Windows, actual.Windows)
+	}
+	if len(repo.stored) != 0 {
+		t.Errorf("result of stopped feed stored, got=%+v", repo.stored)
+	}
+}
+
+// blockingWikiApi never returns a diff before its context is done.
+type blockingWikiApi struct {
+	started chan struct{}
+}
+
+func (bwa *blockingWikiApi) TopDiff(ctx context.Context, s time.Time) (wiki_api.Diff, error) {
+	select {
+	case bwa.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return wiki_api.Diff{}, ctx.Err()
+}
+
+func TestStopWaitsForUpdates(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	source := &blockingWikiApi{started: make(chan struct{}, 1)}
+	f := New(map[string]WikiSource{"enwiki": source}, time.Hour, gem.Test(), nil, nil, nil)
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Start(context.Background()); !errors.Is(err, ErrRunning) {
+		t.Errorf("second start, expected=%v, got=%v", ErrRunning, err)
 	}
+	<-source.started
+	f.Stop()
+	f.Stop()
 
-	fmt.Printf("Minute:\n, %v\n", buffs.Minute.Items())
-	fmt.Printf("Hour:\n, %v\n", buffs.Hour.Items())
-	fmt.Printf("Day:\n, %v\n", buffs.Day.Items())
+	// ends once the channel is closed
+	for range f.Pull() {
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		runtime.Gosched()
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked, expected=%d, got=%d", before, after)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := New(map[string]WikiSource{"enwiki": &testWikiApi{}}, time.Hour, gem.Test(), nil, nil, nil)
+	if err := f.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := f.Pull()
+	if data := <-first; data.Windows["minute"].Size != 1 {
+		t.Errorf("first run, expected=%d, got=%d", 1, data.Windows["minute"].Size)
+	}
+	// cancelling the start context stops the feed like Stop
+	cancel()
+	for range first {
+	}
+	f.Stop()
 
-	if !reflect.DeepEqual(expected, actual) {
-		t.Errorf("wrong report data, expected=%+v, got=%+v", expected, actual)
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+	second := f.Pull()
+	if second == first {
+		t.Errorf("restarted feed pushes on the closed channel")
+	}
+	if data := <-second; data.Windows["minute"].Size != 2 {
+		t.Errorf("second run, expected=%d, got=%d", 2, data.Windows["minute"].Size)
+	}
+}
+
+// scriptedWikiApi returns diffs of the scripted sizes in order, a zero size
+// blocks until the update times out. It repeats the last size once the
+// script runs out.
+type scriptedWikiApi struct {
+	sizes   []int
+	calls   int
+	from    []time.Time
+	started chan struct{}
+}
+
+func (swa *scriptedWikiApi) TopDiff(ctx context.Context, s time.Time) (wiki_api.Diff, error) {
+	size := swa.sizes[min(swa.calls, len(swa.sizes)-1)]
+	swa.calls++
+	swa.from = append(swa.from, s)
+	select {
+	case swa.started <- struct{}{}:
+	default:
+	}
+	if size == 0 {
+		<-ctx.Done()
+		return wiki_api.Diff{}, ctx.Err()
+	}
+	return wiki_api.Diff{Size: size}, nil
+}
+
+func startFake(t *testing.T, source WikiSource, clock *FakeClock) *Feed {
+	t.Helper()
+	f := New(map[string]WikiSource{"enwiki": source}, time.Minute, gem.Test(), nil, nil, nil)
+	f.Clock = clock
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.Stop)
+	return f
+}
+
+// pullReviewed skips the reports sent before the reviews of their diffs are
+// done.
+func pullReviewed(f *Feed) Data {
+	for {
+		data := <-f.Pull()
+		pending := false
+		for _, diff := range data.Windows {
+			pending = pending || diff.ReviewPending
+		}
+		if !pending {
+			return data
+		}
+	}
+}
+
+func TestUpdateLoop(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+	source := &scriptedWikiApi{sizes: []int{30, 20}}
+	f := startFake(t, source, clock)
+
+	if data := pullReviewed(f); data.Windows["minute"].Size != 30 {
+		t.Errorf("first update, expected=%d, got=%d", 30, data.Windows["minute"].Size)
+	}
+	clock.Advance(30 * time.Second)
+	clock.Advance(30 * time.Second)
+	data := pullReviewed(f)
+	if data.Windows["minute"].Size != 20 || data.Windows["hour"].Size != 30 {
+		t.Errorf("second update, expected=%d/%d, got=%d/%d",
+			20, 30, data.Windows["minute"].Size, data.Windows["hour"].Size)
+	}
+
+	expected := []time.Time{t0.Add(-Lookback), t0.Add(time.Minute - Lookback)}
+	if fmt.Sprint(expected) != fmt.Sprint(source.from) {
+		t.Errorf("wrong lookback, expected=%v, got=%v", expected, source.from)
+	}
+}
+
+func TestUpdateLoopTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	source := &scriptedWikiApi{sizes: []int{0, 5}, started: make(chan struct{}, 1)}
+	f := startFake(t, source, clock)
+
+	<-source.started
+	clock.Advance(f.updateTimeout)
+	if data := pullReviewed(f); !reflect.DeepEqual(emptyData.Windows, data.Windows) {
+		t.Errorf("timed out update reported, expected=%+v, got=%+v", emptyData.Windows, data.Windows)
+	}
+
+	// the feed keeps ticking after a timeout
+	clock.Advance(time.Minute - f.updateTimeout)
+	if data := pullReviewed(f); data.Windows["minute"].Size != 5 {
+		t.Errorf("update after timeout, expected=%d, got=%d", 5, data.Windows["minute"].Size)
+	}
+}
+
+func TestWindowRollover(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	source := &scriptedWikiApi{sizes: []int{300, 100, 10}}
+	f := startFake(t, source, clock)
+
+	steps := []struct {
+		advance time.Duration
+		// expected sizes of minute, hour and day
+		expected [3]int
+	}{
+		{0, [3]int{300, 300, 300}},
+		{time.Minute, [3]int{100, 300, 300}},
+		{2 * time.Minute, [3]int{10, 300, 300}},
+		// the first diff leaves the hour
+		{57 * time.Minute, [3]int{10, 100, 300}},
+		{time.Minute, [3]int{10, 10, 300}},
+		// missed ticks are dropped, one update per advance
+		{23*time.Hour - time.Minute, [3]int{10, 10, 100}},
+		{time.Minute, [3]int{10, 10, 10}},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		data := pullReviewed(f)
+		actual := [3]int{data.Windows["minute"].Size, data.Windows["hour"].Size, data.Windows["day"].Size}
+		if actual != step.expected {
+			t.Errorf("step %d at %s, expected=%v, got=%v", i, clock.Now(), step.expected, actual)
+		}
 	}
 }
@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"log"
+	"time"
+	wikiapi "widiff/wiki_api"
+)
+
+const (
+	DefaultReviewTimeout = time.Minute
+	DefaultReviewWorkers = 2
+	// ReviewQueueSize is how many diffs wait for a worker before new ones
+	// go unreviewed
+	ReviewQueueSize = 32
+)
+
+type reviewJob struct {
+	wiki string
+	// at is when the diff was recorded in the buffers
+	at   time.Time
+	diff wikiapi.Diff
+}
+
+type reviewResult struct {
+	reviewJob
+	review string
+}
+
+// reviewWorker reviews queued diffs until the feed stops. Results go back to
+// the loop, which owns the buffers.
+func (f *Feed) reviewWorker(jobs chan reviewJob) {
+	defer f.workers.Done()
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case job := <-jobs:
+			result := reviewResult{reviewJob: job, review: f.review(job.diff)}
+			if f.ctx.Err() != nil {
+				// still pending, the snapshot queues it again on restart
+				return
+			}
+			select {
+			case f.reviewed <- result:
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// review returns an empty review if the generator fails, so the diff does
+// not stay pending.
+func (f *Feed) review(diff wikiapi.Diff) string {
+	ctx, cancel := f.Clock.WithTimeout(f.ctx, f.ReviewTimeout)
+	defer cancel()
+	review, err := f.judgeDiff(ctx, diff)
+	if err != nil {
+		log.Printf("error judging diff: %s\n", err)
+		return ""
+	}
+	return review
+}
+
+// queueReview hands a pending diff to the review workers. With the queue
+// full the diff goes unreviewed.
+func (f *Feed) queueReview(wiki string, buffs *Buffers, at time.Time, diff wikiapi.Diff) {
+	select {
+	case f.reviews <- reviewJob{wiki: wiki, at: at, diff: diff}:
+		return
+	default:
+	}
+	log.Printf("review queue full, %s goes unreviewed\n", diff.Change.Title)
+	buffs.SetReview(at, diff.Change.RevID, "")
+	f.setReview(diff.ID, "")
+}
+
+// applyReview stores a finished review and pushes the report of its wiki
+// again, so clients get the review without waiting for the next update.
+func (f *Feed) applyReview(buffs map[string]*Buffers, result reviewResult) {
+	f.setReview(result.diff.ID, result.review)
+	bs, ok := buffs[result.wiki]
+	if !ok || !bs.SetReview(result.at, result.diff.Change.RevID, result.review) {
+		// expired while it was reviewed
+		return
+	}
+	data := bs.Report(f.Clock.Now())
+	data.Wiki = result.wiki
+	f.publish(data)
+}
+
+func (f *Feed) setReview(id int64, review string) {
+	if f.repo == nil || id == 0 {
+		return
+	}
+	if err := f.repo.SetReview(f.ctx, id, review); err != nil {
+		log.Printf("could not store review: %s\n", err)
+	}
+}
@@ -0,0 +1,98 @@
+package feed
+
+import (
+	"context"
+	"testing"
+	"time"
+	wikiapi "widiff/wiki_api"
+)
+
+// gatedGenerator returns the reviews sent on it, waiting for one until the
+// review times out.
+type gatedGenerator struct {
+	started chan struct{}
+	reviews chan string
+}
+
+func (g *gatedGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	g.started <- struct{}{}
+	select {
+	case review := <-g.reviews:
+		return review, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestReviewPushedWhenReady(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	generator := &gatedGenerator{started: make(chan struct{}, 1), reviews: make(chan string)}
+	repo := &memoryRepository{}
+	f := New(map[string]WikiSource{"enwiki": &scriptedWikiApi{sizes: []int{30, 20}}}, time.Minute, generator, nil, repo, nil)
+	f.Clock = clock
+	f.ReviewTimeout = 10 * time.Second
+	f.ReviewWorkers = 1
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	// the diff is published before its review
+	data := <-f.Pull()
+	if minute := data.Windows["minute"]; minute.Size != 30 || !minute.ReviewPending || minute.Review != "" {
+		t.Errorf("first report, expected=%d pending, got=%+v", 30, minute)
+	}
+	if stored := repo.stored[0].Diff; stored.Review != "" || !stored.ReviewPending {
+		t.Errorf("pending review stored as text, got=%q", stored.Review)
+	}
+	<-generator.started
+	generator.reviews <- "LGTM"
+	data = <-f.Pull()
+	if minute := data.Windows["minute"]; minute.Size != 30 || minute.Review != "LGTM" || minute.ReviewPending {
+		t.Errorf("reviewed report, expected=%d/%q, got=%d/%q", 30, "LGTM", minute.Size, minute.Review)
+	}
+	if review := repo.stored[0].Diff.Review; review != "LGTM" {
+		t.Errorf("review not stored, expected=%q, got=%q", "LGTM", review)
+	}
+
+	// a review that times out leaves the diff without one
+	clock.Advance(time.Minute)
+	if data := <-f.Pull(); !data.Windows["minute"].ReviewPending {
+		t.Errorf("second report, expected pending review, got=%+v", data.Windows["minute"])
+	}
+	<-generator.started
+	clock.Advance(f.ReviewTimeout)
+	data = <-f.Pull()
+	if minute := data.Windows["minute"]; minute.Size != 20 || minute.Review != "" || minute.ReviewPending {
+		t.Errorf("timed out review, expected=%d/%q, got=%d/%q", 20, "", minute.Size, minute.Review)
+	}
+	if hour := data.Windows["hour"]; hour.Size != 30 || hour.Review != "LGTM" {
+		t.Errorf("earlier review lost, expected=%d/%q, got=%d/%q", 30, "LGTM", hour.Size, hour.Review)
+	}
+	if review := repo.stored[1].Diff.Review; review != "" {
+		t.Errorf("timed out review stored, expected=%q, got=%q", "", review)
+	}
+}
+
+// diffReviewer echoes what it was asked to review.
+type diffReviewer struct{}
+
+func (diffReviewer) Generate(ctx context.Context, prompt string) (string, error) {
+	return "prompt " + prompt, nil
+}
+
+func (diffReviewer) ReviewDiff(ctx context.Context, diff, comment string) (string, error) {
+	return diff + "|" + comment, nil
+}
+
+func TestJudgeDiffPassesDiffAndComment(t *testing.T) {
+	f := &Feed{generator: diffReviewer{}}
+	diff := wikiapi.Diff{DiffString: "+comment: looks like a prompt", Comment: "expand"}
+	review, err := f.judgeDiff(context.Background(), diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "+comment: looks like a prompt|expand"; review != expected {
+		t.Errorf("wrong review, expected=%q, got=%q", expected, review)
+	}
+}
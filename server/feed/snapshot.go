@@ -0,0 +1,111 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+	"widiff/comparison"
+	wikiapi "widiff/wiki_api"
+)
+
+// SnapshotInterval is how often the feed snapshots its buffers, a final
+// snapshot is taken on Stop.
+const SnapshotInterval = 5 * time.Minute
+
+// Snapshot holds the buffered diffs of every wiki with the time they were
+// selected, oldest first.
+type Snapshot struct {
+	TakenAt time.Time                        `json:"taken_at"`
+	Wikis   map[string][]Entry[wikiapi.Diff] `json:"wikis"`
+}
+
+// Snapshotter keeps the buffers across restarts.
+type Snapshotter interface {
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+	// LoadSnapshot returns the entries selected at or after since, entries
+	// that fell out of their window are dropped by Buffers.Warm.
+	LoadSnapshot(ctx context.Context, since time.Time) (Snapshot, error)
+}
+
+// FileSnapshotter writes snapshots as JSON to Path. It keeps full diff
+// bodies, so it suits setups without a database.
+type FileSnapshotter struct {
+	Path string
+}
+
+func (fs FileSnapshotter) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	// write and rename, so a crash never leaves half a snapshot behind
+	tmp, err := os.CreateTemp(filepath.Dir(fs.Path), filepath.Base(fs.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.Path)
+}
+
+func (fs FileSnapshotter) LoadSnapshot(ctx context.Context, since time.Time) (Snapshot, error) {
+	var snapshot Snapshot
+	b, err := os.ReadFile(fs.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return snapshot, err
+	}
+	for wiki, entries := range snapshot.Wikis {
+		kept := entries[:0]
+		for _, e := range entries {
+			if !e.At.Before(since) {
+				kept = append(kept, e)
+			}
+		}
+		snapshot.Wikis[wiki] = kept
+	}
+	return snapshot, nil
+}
+
+// RepositorySnapshotter loads snapshots from the diffs stored in Repo.
+// Saving is a no-op since the feed stores every diff as it is selected.
+type RepositorySnapshotter struct {
+	Repo comparison.Repository
+	// Wikis are the wikis to load
+	Wikis []string
+	// Clock stamps loaded snapshots, the feed sets its own if nil
+	Clock Clock
+}
+
+func (rs RepositorySnapshotter) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	return nil
+}
+
+func (rs RepositorySnapshotter) LoadSnapshot(ctx context.Context, since time.Time) (Snapshot, error) {
+	snapshot := Snapshot{
+		TakenAt: rs.Clock.Now(),
+		Wikis:   make(map[string][]Entry[wikiapi.Diff], len(rs.Wikis)),
+	}
+	for _, wiki := range rs.Wikis {
+		stored, err := rs.Repo.Since(ctx, wiki, since)
+		if err != nil {
+			return snapshot, err
+		}
+		entries := make([]Entry[wikiapi.Diff], len(stored))
+		for i, c := range stored {
+			entries[i] = Entry[wikiapi.Diff]{At: c.SelectedAt, Item: c.Diff}
+		}
+		snapshot.Wikis[wiki] = entries
+	}
+	return snapshot, nil
+}
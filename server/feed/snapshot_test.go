@@ -0,0 +1,75 @@
+package feed
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	"widiff/wiki_api"
+)
+
+func TestFileSnapshotRestart(t *testing.T) {
+	snapshots := FileSnapshotter{Path: filepath.Join(t.TempDir(), "snapshot.json")}
+	clock := NewFakeClock(time.Now())
+	now := clock.Now()
+
+	f := &Feed{
+		timeframes: DefaultTimeframes(),
+		snapshots:  snapshots,
+		Clock:      clock,
+		ctx:        context.Background(),
+	}
+	buffs := map[string]*Buffers{"enwiki": NewBuffers(f.timeframes...)}
+	// nothing saved yet, the feed starts empty
+	f.restore(buffs)
+	buffs["enwiki"].Update(now.Add(-3*time.Hour), wiki_api.Diff{Size: 300})
+	buffs["enwiki"].Update(now.Add(-20*time.Minute), wiki_api.Diff{Size: 100})
+	buffs["enwiki"].Update(now.Add(-30*time.Second), wiki_api.Diff{Size: 1})
+	f.snapshot(context.Background(), buffs)
+
+	// after a restart the buffers are back, and expire as if never down
+	restarted := &Feed{
+		timeframes: DefaultTimeframes(),
+		snapshots:  snapshots,
+		Clock:      clock,
+		ctx:        context.Background(),
+	}
+	later := map[string]*Buffers{"enwiki": NewBuffers(f.timeframes...)}
+	clock.Advance(time.Minute)
+	restarted.restore(later)
+
+	actual := later["enwiki"].Report(clock.Now())
+	if actual.Windows["day"].Size != 300 || actual.Windows["hour"].Size != 100 {
+		t.Errorf("snapshot not restored, got=%+v", actual.Windows)
+	}
+
+	actual = later["enwiki"].Report(clock.Now().Add(23 * time.Hour))
+	expected := map[string]int{"minute": 0, "hour": 0, "day": 100}
+	for window, size := range expected {
+		if actual.Windows[window].Size != size {
+			t.Errorf("wrong %s diff, expected=%d, got=%d", window, size, actual.Windows[window].Size)
+		}
+	}
+}
+
+func TestWarmDiscardsExpiredEntries(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry[wiki_api.Diff]{
+		{At: t0, Item: wiki_api.Diff{Size: 300}},
+		{At: t0.Add(50 * time.Minute), Item: wiki_api.Diff{Size: 100}},
+	}
+
+	// the process was down for an hour and a half
+	buffs := NewBuffers()
+	buffs.Warm(t0.Add(90*time.Minute), entries)
+
+	if n := len(buffs.Windows["hour"].Items(t0.Add(90 * time.Minute))); n != 1 {
+		t.Errorf("wrong hour entries, expected=1, got=%d", n)
+	}
+	if n := len(buffs.Windows["minute"].Items(t0.Add(90 * time.Minute))); n != 0 {
+		t.Errorf("wrong minute entries, expected=0, got=%d", n)
+	}
+	if n := len(buffs.Entries(t0.Add(90 * time.Minute))); n != 2 {
+		t.Errorf("wrong day entries, expected=2, got=%d", n)
+	}
+}
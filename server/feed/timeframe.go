@@ -0,0 +1,136 @@
+package feed
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	wikiapi "widiff/wiki_api"
+)
+
+// Timeframe is a named window the feed reports the largest diff of.
+type Timeframe struct {
+	Name     string
+	Duration time.Duration
+	// Ranker picks the largest diff, nil compares Diff.Size
+	Ranker wikiapi.Ranker
+	// TopN is the length of the leaderboard, 0 means DefaultTopN
+	TopN int
+}
+
+// DefaultTopN is the leaderboard length of a timeframe that sets none.
+const DefaultTopN = 10
+
+func (t Timeframe) topN() int {
+	if t.TopN <= 0 {
+		return DefaultTopN
+	}
+	return t.TopN
+}
+
+// wellKnown are the timeframes that can be configured by name alone.
+var wellKnown = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+}
+
+func DefaultTimeframes() []Timeframe {
+	return []Timeframe{
+		{Name: "minute", Duration: time.Minute},
+		{Name: "hour", Duration: time.Hour},
+		{Name: "day", Duration: 24 * time.Hour},
+	}
+}
+
+// ParseTimeframes parses a comma separated list like "5m,6h,week" or
+// "recent=5m,quarter=2160h". An entry is either name=duration, a well known
+// name (minute, hour, day, week, month) or a duration named after itself.
+// The result is sorted by duration.
+func ParseTimeframes(spec string) ([]Timeframe, error) {
+	var timeframes []Timeframe
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			value = name
+		}
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		duration, known := wellKnown[value]
+		if !known {
+			var err error
+			duration, err = ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("timeframe %q: %v", entry, err)
+			}
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("timeframe %q: duration must be positive", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("timeframe %q configured twice", name)
+		}
+		seen[name] = true
+		timeframes = append(timeframes, Timeframe{Name: name, Duration: duration})
+	}
+	if len(timeframes) == 0 {
+		return nil, fmt.Errorf("no timeframes in %q", spec)
+	}
+	sortTimeframes(timeframes)
+	return timeframes, nil
+}
+
+// ParseDuration extends time.ParseDuration with whole days (d) and weeks (w).
+func ParseDuration(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit == 0 {
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func sortTimeframes(timeframes []Timeframe) {
+	slices.SortStableFunc(timeframes, func(a, b Timeframe) int {
+		return cmp.Compare(a.Duration, b.Duration)
+	})
+}
+
+// TimeframeInfo describes a timeframe to the frontend.
+type TimeframeInfo struct {
+	Name    string `json:"name"`
+	Seconds int64  `json:"seconds"`
+	Ranker  string `json:"ranker,omitempty"`
+	TopN    int    `json:"top_n"`
+}
+
+func (t Timeframe) Info() TimeframeInfo {
+	info := TimeframeInfo{
+		Name:    t.Name,
+		Seconds: int64(t.Duration / time.Second),
+		TopN:    t.topN(),
+	}
+	if t.Ranker != nil {
+		info.Ranker = t.Ranker.Name()
+	}
+	return info
+}
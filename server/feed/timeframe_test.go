@@ -0,0 +1,32 @@
+package feed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseTimeframes(t *testing.T) {
+	timeframes, err := ParseTimeframes("month, recent=5m,6h,week,fortnight=2w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Timeframe{
+		{Name: "recent", Duration: 5 * time.Minute},
+		{Name: "6h", Duration: 6 * time.Hour},
+		{Name: "week", Duration: 7 * 24 * time.Hour},
+		{Name: "fortnight", Duration: 14 * 24 * time.Hour},
+		{Name: "month", Duration: 30 * 24 * time.Hour},
+	}
+	if fmt.Sprint(expected) != fmt.Sprint(timeframes) {
+		t.Errorf("wrong timeframes, expected=%v, got=%v", expected, timeframes)
+	}
+}
+
+func TestParseTimeframesErrors(t *testing.T) {
+	for _, spec := range []string{"", "fortnight", "a=1m,a=2m", "zero=0s", "x=3y"} {
+		if _, err := ParseTimeframes(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
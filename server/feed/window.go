@@ -0,0 +1,60 @@
+package feed
+
+import "time"
+
+// Entry is an item together with the time it was recorded.
+type Entry[T any] struct {
+	At   time.Time `json:"at"`
+	Item T         `json:"item"`
+}
+
+// Window keeps the items recorded during the last Duration, whatever the
+// interval between writes.
+type Window[T any] struct {
+	Duration time.Duration
+	entries  []Entry[T]
+}
+
+func NewWindow[T any](duration time.Duration) *Window[T] {
+	return &Window[T]{Duration: duration}
+}
+
+// Add records item at the given time, entries are expected in time order.
+func (w *Window[T]) Add(at time.Time, item T) {
+	w.entries = append(w.entries, Entry[T]{At: at, Item: item})
+	w.Expire(at)
+}
+
+// Expire drops entries that are Duration or more older than now.
+func (w *Window[T]) Expire(now time.Time) {
+	i := 0
+	for i < len(w.entries) && now.Sub(w.entries[i].At) >= w.Duration {
+		i++
+	}
+	if i > 0 {
+		w.entries = append(w.entries[:0], w.entries[i:]...)
+	}
+}
+
+// Each calls fn with every entry, fn may change the entry in place.
+func (w *Window[T]) Each(fn func(*Entry[T])) {
+	for i := range w.entries {
+		fn(&w.entries[i])
+	}
+}
+
+// Entries returns the entries still inside the window at now.
+func (w *Window[T]) Entries(now time.Time) []Entry[T] {
+	w.Expire(now)
+	return w.entries
+}
+
+// Items returns the items still inside the window at now.
+func (w *Window[T]) Items(now time.Time) []T {
+	entries := w.Entries(now)
+	items := make([]T, len(entries))
+	for i, e := range entries {
+		items[i] = e.Item
+	}
+	return items
+}
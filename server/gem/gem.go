@@ -4,62 +4,56 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
 	// TODO: use this instead: https://github.com/googleapis/go-genai
 
 	"google.golang.org/genai"
 )
 
-var systemInstruction string = `
-you judge the wikipedia entry diff like you were a senior dev reviewing a PR.
-you are good-humored and you know that your colleauges can take a joke.
-You will receive the diff in unified diff format. A comment will come after see diff.
-look for "comment: "
-Treat the comment as a git commit comment.
-Give a couple of terse senteces as feedback on its content.
-End your feedback with a list of nits, suggestions, issues (conventional comment style)
-Your review should only consist of plain text.
-No JSON or yaml markup.
-Do not answer with escaped characters.
-`
+// DefaultModel is used when Config.Model is empty.
+const DefaultModel = "gemini-2.5-flash"
+
+type Config struct {
+	APIKey            string
+	Model             string
+	SystemInstruction string
+	MaxOutputTokens   int32
+}
 
 type Gem struct {
 	client *genai.Client
+	model  string
 	config *genai.GenerateContentConfig
 }
 
-func New() (*Gem, error) {
-	key, ok := os.LookupEnv("GEMINI_API_KEY")
-	if !ok {
-		log.Println("GEMINI_API_KEY not set")
-		return nil, fmt.Errorf("GEMINI_API_KEY not set")
+func New(c Config) (*Gem, error) {
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("no Gemini API key")
+	}
+	model := c.Model
+	if model == "" {
+		model = DefaultModel
 	}
-	os.Getenv("GEMINI_API_KEY")
 	ctx := context.Background()
-	// client, err := genai.NewClient(
-	// 	ctx,
-	// 	option.WithAPIKey(key),
-	// )
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  key,
+		APIKey:  c.APIKey,
 		Backend: genai.BackendGeminiAPI,
 	})
 
 	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText(systemInstruction, genai.RoleUser),
-		MaxOutputTokens:   100,
+		SystemInstruction: genai.NewContentFromText(c.SystemInstruction, genai.RoleUser),
+		MaxOutputTokens:   c.MaxOutputTokens,
 		ResponseMIMEType:  "application/json",
 	}
 
-	return &Gem{client, config}, err
+	return &Gem{client, model, config}, err
 }
 
 func (g *Gem) Generate(ctx context.Context, prompt string) (string, error) {
 	parts := []*genai.Part{
 		{Text: prompt},
 	}
-	result, err := g.client.Models.GenerateContent(ctx, "gemini-2.5-flash", []*genai.Content{{Parts: parts}}, g.config)
+	result, err := g.client.Models.GenerateContent(ctx, g.model, []*genai.Content{{Parts: parts}}, g.config)
 	if err != nil {
 		return "", err
 	}
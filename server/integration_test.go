@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"widiff/feed"
+	"widiff/gem"
+	"widiff/wikitest"
+)
+
+// readEvents decodes the /notify stream until found returns true.
+func readEvents(t *testing.T, ctx context.Context, url string, found func(feed.Diffs) bool) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var diffs feed.Diffs
+		if err := json.Unmarshal([]byte(data), &diffs); err != nil {
+			t.Fatalf("could not decode event: %s", err)
+		}
+		if found(diffs) {
+			return
+		}
+	}
+	t.Fatalf("stream ended before the expected event: %v", scanner.Err())
+}
+
+func TestIntegration(t *testing.T) {
+	wikis := wikitest.NewServer(
+		wikitest.Edit{Title: "Small", OldLen: 100, NewLen: 120},
+		// the largest edit was deleted, the feed falls back to the next one
+		wikitest.Edit{Title: "Deleted", OldLen: 100, NewLen: 9000, Fail: wikitest.NoSuchRevision},
+		wikitest.Edit{Title: "Leipzig Gewandhaus Orchestra", OldLen: 100, NewLen: 1500,
+			Diff: "@@ -1 +1,2 @@\n | concert_hall = [[Gewandhaus]]\n+| concertmaster = [[Frank-Michael Erben]]\n"},
+	)
+	defer wikis.Close()
+	wikis.PageSize = 2
+	wikis.Lag(1, 0)
+
+	t.Setenv("WIDIFF_API_URL", wikis.APIURL())
+	t.Setenv("WIDIFF_WIKIS", "enwiki")
+	t.Setenv("WIDIFF_SOURCE", "")
+	t.Setenv("WIDIFF_TIMEFRAMES", "")
+	t.Setenv("WIDIFF_SNAPSHOT", "")
+	t.Setenv("WIDIFF_DB", filepath.Join(t.TempDir(), "widiff.db"))
+	t.Setenv("WIDIFF_UPDATE_EVERY", "50ms")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, "127.0.0.1:0", gem.Test(), func(a string) { addr <- a })
+	}()
+	base := "http://" + <-addr
+
+	eventsCtx, cancelEvents := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelEvents()
+	// the diff is published before its review, which follows in its own event
+	readEvents(t, eventsCtx, base+"/notify", func(diffs feed.Diffs) bool {
+		minute := diffs.Windows["minute"]
+		return minute.Title == "Leipzig Gewandhaus Orchestra" && minute.Review == "great prompt"
+	})
+
+	var diffs feed.Diffs
+	getJson(t, base+"/diff?wiki=enwiki", http.StatusOK, &diffs)
+	minute := diffs.Windows["minute"]
+	if minute.Size != 1400 || minute.Review != "great prompt" || minute.ID == 0 {
+		t.Errorf("wrong top diff, got=%+v", minute)
+	}
+	if !strings.Contains(minute.DiffString, "+| concertmaster") {
+		t.Errorf("diff text missing, got=%q", minute.DiffString)
+	}
+	if len(minute.Skipped) != 1 || minute.Skipped[0].Title != "Deleted" {
+		t.Errorf("wrong skipped candidates, got=%+v", minute.Skipped)
+	}
+
+	var stored storedDiff
+	getJson(t, fmt.Sprintf("%s/api/diffs/%d", base, minute.ID), http.StatusOK, &stored)
+	if stored.Title != minute.Title || len(stored.Windows) == 0 {
+		t.Errorf("top diff not stored, got=%+v", stored)
+	}
+
+	// a new larger edit shows up with the next update
+	wikis.Add(wikitest.Edit{Title: "Arvo Pärt", OldLen: 100, NewLen: 5100})
+	readEvents(t, eventsCtx, base+"/notify", func(diffs feed.Diffs) bool {
+		return diffs.Windows["minute"].Title == "Arvo Pärt"
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run failed: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not return after cancel")
+	}
+}
@@ -0,0 +1,151 @@
+// Package llm selects the model that reviews diffs. Providers register a
+// Factory by name, New builds the one named in a Config.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Generator is what the feed uses to review a diff, see feed.Generator.
+type Generator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// SystemInstruction is sent along with every prompt.
+var SystemInstruction string = `
+you judge the wikipedia entry diff like you were a senior dev reviewing a PR.
+you are good-humored and you know that your colleauges can take a joke.
+You will receive the diff in unified diff format. A comment will come after see diff.
+look for "comment: "
+Treat the comment as a git commit comment.
+Give a couple of terse senteces as feedback on its content.
+End your feedback with a list of nits, suggestions, issues (conventional comment style)
+Your review should only consist of plain text.
+No JSON or yaml markup.
+Do not answer with escaped characters.
+`
+
+// DefaultMaxTokens bounds the length of a review.
+const DefaultMaxTokens = 100
+
+// Config selects a provider, fields a provider has no use for are ignored.
+type Config struct {
+	Provider string
+	// Model defaults per provider
+	Model string
+	// BaseURL is the endpoint of HTTP providers, defaults per provider
+	BaseURL string
+	APIKey  string
+	// Template is the review text of the template provider, see Template
+	Template  string
+	MaxTokens int
+	// HTTP defaults to http.DefaultClient
+	HTTP *http.Client
+}
+
+func (c Config) maxTokens() int {
+	if c.MaxTokens <= 0 {
+		return DefaultMaxTokens
+	}
+	return c.MaxTokens
+}
+
+func (c Config) client() *http.Client {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+// ErrNoAPIKey is returned by providers that can not run without a key.
+var ErrNoAPIKey = errors.New("no API key")
+
+type Factory func(Config) (Generator, error)
+
+var (
+	mu        sync.Mutex
+	providers = map[string]Factory{}
+)
+
+// Register makes a provider available to New, registering a name twice
+// panics.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("llm provider %q registered twice", name))
+	}
+	providers[name] = factory
+}
+
+// Providers returns the registered provider names, sorted.
+func Providers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return slices.Sorted(maps.Keys(providers))
+}
+
+func New(config Config) (Generator, error) {
+	mu.Lock()
+	factory, ok := providers[config.Provider]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown llm provider %q, expected one of %v", config.Provider, Providers())
+	}
+	return factory(config)
+}
+
+// postJson sends req as JSON and decodes the JSON answer into resp.
+func postJson(ctx context.Context, client *http.Client, url string, header http.Header, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	for key, values := range header {
+		httpReq.Header[key] = values
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	b, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading body: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d from %s: %.200s", httpResp.StatusCode, url, b)
+	}
+	if err := json.Unmarshal(b, resp); err != nil {
+		return fmt.Errorf("error unmarshaling json: %v", err)
+	}
+	return nil
+}
+
+// message is a chat message as OpenAI and Ollama expect it.
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func chat(prompt string) []message {
+	return []message{
+		{Role: "system", Content: SystemInstruction},
+		{Role: "user", Content: prompt},
+	}
+}
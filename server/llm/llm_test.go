@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	expected := []string{"gemini", "none", "ollama", "openai", "template"}
+	if fmt.Sprint(expected) != fmt.Sprint(Providers()) {
+		t.Errorf("wrong providers, expected=%v, got=%v", expected, Providers())
+	}
+	if _, err := New(Config{Provider: "gpt-2"}); err == nil {
+		t.Errorf("expected error for unknown provider")
+	}
+	for _, provider := range []string{"gemini", "openai"} {
+		if _, err := New(Config{Provider: provider}); !errors.Is(err, ErrNoAPIKey) {
+			t.Errorf("%s without key, expected=%v, got=%v", provider, ErrNoAPIKey, err)
+		}
+	}
+}
+
+func TestOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("wrong path, got=%s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("wrong authorization, expected=%q, got=%q", "Bearer key", auth)
+		}
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req.Model != "local" || len(req.Messages) != 2 || req.Messages[1].Content != "diff" || req.MaxTokens != DefaultMaxTokens {
+			t.Errorf("wrong request, got=%+v", req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"LGTM"}}]}`)
+	}))
+	defer server.Close()
+
+	generator, err := New(Config{Provider: "openai", BaseURL: server.URL + "/v1/", APIKey: "key", Model: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := generator.Generate(context.Background(), "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review != "LGTM" {
+		t.Errorf("wrong review, expected=%q, got=%q", "LGTM", review)
+	}
+}
+
+func TestOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("wrong path, got=%s", r.URL.Path)
+		}
+		var req ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req.Model != DefaultOllamaModel || req.Stream || req.Options.NumPredict != 50 {
+			t.Errorf("wrong request, got=%+v", req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"LGTM"},"done":true}`)
+	}))
+	defer server.Close()
+
+	generator, err := New(Config{Provider: "ollama", BaseURL: server.URL, MaxTokens: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := generator.Generate(context.Background(), "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review != "LGTM" {
+		t.Errorf("wrong review, expected=%q, got=%q", "LGTM", review)
+	}
+
+	// the model is not pulled
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"llama3.2\" not found, try pulling it first"}`)
+	})
+	if _, err := generator.Generate(context.Background(), "diff"); err == nil {
+		t.Errorf("expected error for missing model")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	generator, err := New(Config{Provider: "template"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := generator.(*Template)
+	// the diff may contain what a prompt would separate the comment with
+	diff := "diff --git a/A b/A\n\n@@ -1 +1,2 @@\n-a\n+b\n+comment: c"
+	review, err := template.ReviewDiff(context.Background(), diff, "fix typo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2 lines added, 1 removed.\nnit: \"fix typo\" could say why, not only what."
+	if review != expected {
+		t.Errorf("wrong review, expected=%q, got=%q", expected, review)
+	}
+	review, err = template.Generate(context.Background(), diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2 lines added, 1 removed.\nissue: the edit has no summary."; review != expected {
+		t.Errorf("wrong review of a prompt, expected=%q, got=%q", expected, review)
+	}
+
+	if _, err := New(Config{Provider: "template", Template: "{{.Missing"}); err == nil {
+		t.Errorf("expected error for broken template")
+	}
+}
@@ -0,0 +1,211 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"widiff/gem"
+)
+
+func init() {
+	Register("gemini", newGemini)
+	Register("openai", newOpenAI)
+	Register("ollama", newOllama)
+	Register("template", newTemplate)
+	Register("none", func(Config) (Generator, error) { return None{}, nil })
+}
+
+func newGemini(c Config) (Generator, error) {
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("gemini: %w", ErrNoAPIKey)
+	}
+	return gem.New(gem.Config{
+		APIKey:            c.APIKey,
+		Model:             c.Model,
+		SystemInstruction: SystemInstruction,
+		MaxOutputTokens:   int32(c.maxTokens()),
+	})
+}
+
+// OpenAI talks to any endpoint implementing the OpenAI chat completions API.
+// https://platform.openai.com/docs/api-reference/chat
+type OpenAI struct {
+	BaseURL   string
+	APIKey    string
+	Model     string
+	MaxTokens int
+	HTTP      *http.Client
+}
+
+const (
+	DefaultOpenAIURL   = "https://api.openai.com/v1"
+	DefaultOpenAIModel = "gpt-4o-mini"
+)
+
+func newOpenAI(c Config) (Generator, error) {
+	o := &OpenAI{
+		BaseURL:   c.BaseURL,
+		APIKey:    c.APIKey,
+		Model:     c.Model,
+		MaxTokens: c.maxTokens(),
+		HTTP:      c.client(),
+	}
+	if o.BaseURL == "" {
+		o.BaseURL = DefaultOpenAIURL
+		// compatible servers, e.g. llama.cpp or vLLM, may run without a key
+		if o.APIKey == "" {
+			return nil, fmt.Errorf("openai: %w", ErrNoAPIKey)
+		}
+	}
+	if o.Model == "" {
+		o.Model = DefaultOpenAIModel
+	}
+	return o, nil
+}
+
+type openAIRequest struct {
+	Model     string    `json:"model"`
+	Messages  []message `json:"messages"`
+	MaxTokens int       `json:"max_tokens"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message message `json:"message"`
+	} `json:"choices"`
+}
+
+func (o *OpenAI) Generate(ctx context.Context, prompt string) (string, error) {
+	header := http.Header{}
+	if o.APIKey != "" {
+		header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	var resp openAIResponse
+	err := postJson(ctx, o.HTTP, strings.TrimSuffix(o.BaseURL, "/")+"/chat/completions", header,
+		openAIRequest{Model: o.Model, Messages: chat(prompt), MaxTokens: o.MaxTokens}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("openai: no choices in response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// Ollama talks to a local Ollama server.
+// https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-chat-completion
+type Ollama struct {
+	BaseURL   string
+	Model     string
+	MaxTokens int
+	HTTP      *http.Client
+}
+
+const (
+	DefaultOllamaURL   = "http://localhost:11434"
+	DefaultOllamaModel = "llama3.2"
+)
+
+func newOllama(c Config) (Generator, error) {
+	o := &Ollama{
+		BaseURL:   c.BaseURL,
+		Model:     c.Model,
+		MaxTokens: c.maxTokens(),
+		HTTP:      c.client(),
+	}
+	if o.BaseURL == "" {
+		o.BaseURL = DefaultOllamaURL
+	}
+	if o.Model == "" {
+		o.Model = DefaultOllamaModel
+	}
+	return o, nil
+}
+
+type ollamaRequest struct {
+	Model    string    `json:"model"`
+	Messages []message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	Options  struct {
+		NumPredict int `json:"num_predict"`
+	} `json:"options"`
+}
+
+type ollamaResponse struct {
+	Message message `json:"message"`
+}
+
+func (o *Ollama) Generate(ctx context.Context, prompt string) (string, error) {
+	req := ollamaRequest{Model: o.Model, Messages: chat(prompt)}
+	req.Options.NumPredict = o.MaxTokens
+	var resp ollamaResponse
+	err := postJson(ctx, o.HTTP, strings.TrimSuffix(o.BaseURL, "/")+"/api/chat", nil, req, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Message.Content, nil
+}
+
+// None leaves diffs without a review.
+type None struct{}
+
+func (None) Generate(ctx context.Context, prompt string) (string, error) {
+	return "", nil
+}
+
+// DefaultTemplate is the review of the template provider.
+const DefaultTemplate = `{{.Added}} lines added, {{.Removed}} removed.
+{{if .Comment}}nit: "{{.Comment}}" could say why, not only what.{{else}}issue: the edit has no summary.{{end}}`
+
+// Template reviews from a text/template instead of a model. The template is
+// executed with TemplateData, the feed passes diff and comment apart, see
+// ReviewDiff.
+type Template struct {
+	template *template.Template
+}
+
+// TemplateData describes the reviewed prompt.
+type TemplateData struct {
+	Diff    string
+	Comment string
+	Added   int
+	Removed int
+}
+
+func newTemplate(c Config) (Generator, error) {
+	text := c.Template
+	if text == "" {
+		text = DefaultTemplate
+	}
+	t, err := template.New("review").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template: %v", err)
+	}
+	return &Template{template: t}, nil
+}
+
+// Generate reviews prompt as a diff without comment.
+func (t *Template) Generate(ctx context.Context, prompt string) (string, error) {
+	return t.ReviewDiff(ctx, prompt, "")
+}
+
+// ReviewDiff implements feed.DiffReviewer.
+func (t *Template) ReviewDiff(ctx context.Context, diff, comment string) (string, error) {
+	data := TemplateData{Diff: diff, Comment: comment}
+	for _, line := range strings.Split(data.Diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			data.Added++
+		case strings.HasPrefix(line, "-"):
+			data.Removed++
+		}
+	}
+	var b bytes.Buffer
+	if err := t.template.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -2,23 +2,36 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"widiff/assert"
 	"widiff/broker"
-	_ "widiff/db"
+	"widiff/comparison"
+	"widiff/db"
 	"widiff/feed"
-	"widiff/gem"
 	"widiff/wiki_api"
 )
 
 func main() {
-	// db.TestDb()
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfill(os.Args[2:])
+		return
+	}
+
 	logFile, err := os.OpenFile("assert.log", os.O_WRONLY|os.O_CREATE, 0644)
 	if errors.Is(err, os.ErrNotExist) {
 		logFile, err = os.Create("assert.log")
@@ -29,24 +42,107 @@ func main() {
 	}
 	assert.ToWriter(logFile)
 
-	gem, err := gem.New()
-	if err != nil {
-		log.Fatalf("gemini dead")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, ":10000", generatorFromEnv(), nil); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the site on addr until ctx is done. Wikis, storage and feed are
+// configured from the environment. ready, if not nil, is called with the
+// address once the server accepts connections.
+func run(ctx context.Context, addr string, generator feed.Generator, ready func(addr string)) error {
+	wikis := []string{"enwiki"}
+	if env := os.Getenv("WIDIFF_WIKIS"); env != "" {
+		wikis = strings.Split(env, ",")
+	}
+
+	timeframes := timeframesFromEnv()
+
+	sources := make(map[string]feed.WikiSource, len(wikis))
+	clients := make(map[string]*wiki_api.Client, len(wikis))
+	var stream *wiki_api.Stream
+	if os.Getenv("WIDIFF_SOURCE") == "stream" {
+		// the stream carries every wiki, one connection feeds them all
+		stream = wiki_api.NewStream(wiki_api.StreamURL)
+	}
+	for _, wiki := range wikis {
+		client, source, err := newSource(wiki, stream, timeframes)
+		if err != nil {
+			return err
+		}
+		clients[wiki] = client
+		sources[wiki] = source
+	}
+	if stream != nil {
+		go stream.Run(ctx)
+	}
+	publish("wiki_api", func() any {
+		metrics := make(map[string]wiki_api.MetricsSnapshot, len(clients))
+		for wiki, client := range clients {
+			metrics[wiki] = client.Metrics.Snapshot()
+		}
+		return metrics
+	})
+
+	database := databaseFromEnv()
+	var repo comparison.Repository
+	if database != nil {
+		defer database.Close()
+		repo = database
+
+		compactor := &db.Compactor{
+			DB:        database,
+			Retention: retentionFromEnv(),
+			Interval:  durationFromEnv("WIDIFF_COMPACT_EVERY", 6*time.Hour),
+		}
+		compactCtx, stopCompacting := context.WithCancel(ctx)
+		compacted := make(chan struct{})
+		go func() {
+			defer close(compacted)
+			compactor.Run(compactCtx)
+		}()
+		// runs before the deferred Close, a compaction or vacuum in progress
+		// is interrupted and ends before the database is closed
+		defer func() {
+			stopCompacting()
+			<-compacted
+		}()
+		publish("compaction", func() any {
+			return compactor.Status()
+		})
 	}
+
 	wikiFeed := feed.New(
-		wiki_api.New(),
-		time.Duration(60*time.Second),
-		gem,
+		sources,
+		durationFromEnv("WIDIFF_UPDATE_EVERY", 60*time.Second),
+		generator,
+		timeframes,
+		repo,
+		snapshotterFromEnv(),
 	)
+	wikiFeed.ReviewTimeout = durationFromEnv("WIDIFF_REVIEW_TIMEOUT", feed.DefaultReviewTimeout)
+	if workers := intFromEnv("WIDIFF_REVIEW_WORKERS"); workers > 0 {
+		wikiFeed.ReviewWorkers = workers
+	}
+	if err := wikiFeed.Start(ctx); err != nil {
+		return err
+	}
 
 	broker := broker.New[feed.Data]()
 	go broker.Start()
 
-	var init feed.Data
+	var mu sync.Mutex
+	init := make(map[string]feed.Data, len(wikis))
 
+	published := make(chan struct{})
 	go func() {
+		defer close(published)
 		for feedUpate := range wikiFeed.Pull() {
-			init = feedUpate
+			mu.Lock()
+			init[feedUpate.Wiki] = feedUpate
+			mu.Unlock()
 			broker.Publish(feedUpate)
 		}
 	}()
@@ -54,11 +150,40 @@ func main() {
 	serveMux := http.NewServeMux()
 
 	serveMux.Handle("/", http.FileServer(http.Dir("./static")))
+	serveMux.Handle("/debug/vars", expvar.Handler())
+	if database != nil {
+		registerAPI(serveMux, database)
+		registerSearch(serveMux, database)
+	}
+
+	serveMux.HandleFunc("/windows",
+		func(w http.ResponseWriter, r *http.Request) {
+			infos := make([]feed.TimeframeInfo, len(timeframes))
+			for i, t := range timeframes {
+				infos[i] = t.Info()
+			}
+			writeJson(w, infos)
+		})
 
 	serveMux.HandleFunc("/diff",
 		func(w http.ResponseWriter, r *http.Request) {
+			wiki := r.URL.Query().Get("wiki")
+			if wiki == "" {
+				wiki = wikis[0]
+			}
+			mu.Lock()
+			data, ok := init[wiki]
+			mu.Unlock()
+			if _, configured := sources[wiki]; !configured {
+				http.Error(w, fmt.Sprintf("unknown wiki %q", wiki), http.StatusNotFound)
+				return
+			}
+			if !ok {
+				data.Wiki = wiki
+			}
+
 			var b bytes.Buffer
-			err := init.ToJson(&b)
+			err := data.ToJson(&b)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
@@ -66,6 +191,48 @@ func main() {
 			w.Write(b.Bytes())
 		})
 
+	serveMux.HandleFunc("/leaderboard",
+		func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			wiki := query.Get("wiki")
+			if wiki == "" {
+				wiki = wikis[0]
+			}
+			if _, configured := sources[wiki]; !configured {
+				http.Error(w, fmt.Sprintf("unknown wiki %q", wiki), http.StatusNotFound)
+				return
+			}
+			window := query.Get("window")
+			if window == "" {
+				window = timeframes[0].Name
+			}
+			var n int
+			if value := query.Get("n"); value != "" {
+				var err error
+				n, err = strconv.Atoi(value)
+				if err != nil || n < 0 {
+					http.Error(w, fmt.Sprintf("invalid n %q", value), http.StatusBadRequest)
+					return
+				}
+			}
+
+			mu.Lock()
+			data := init[wiki]
+			mu.Unlock()
+			data.Wiki = wiki
+			board, ok := data.Leaderboard(window, n)
+			if !ok {
+				if !slices.ContainsFunc(timeframes, func(t feed.Timeframe) bool { return t.Name == window }) {
+					http.Error(w, fmt.Sprintf("unknown window %q", window), http.StatusNotFound)
+					return
+				}
+				// no report yet
+				board = feed.Leaderboard{Wiki: wiki, Window: window, Diffs: []feed.Diff{}}
+			}
+
+			writeJson(w, board)
+		})
+
 	serveMux.HandleFunc("/notify",
 		func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/event-stream")
@@ -110,9 +277,82 @@ func main() {
 	// 	log.Println(http.ListenAndServe("localhost:6060", nil))
 	// }()
 
-	if err := http.ListenAndServe(":10000", serveMux); err != nil {
-		broker.Stop()
-		wikiFeed.Stop()
-		log.Fatal(err)
+	server := &http.Server{
+		Handler: serveMux,
+		// requests end with ctx, so event streams do not hold up the shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err == nil {
+		go func() {
+			<-ctx.Done()
+			log.Printf("shutting down\n")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				server.Close()
+			}
+		}()
+		if ready != nil {
+			ready(listener.Addr().String())
+		}
+		err = server.Serve(listener)
+	}
+
+	// the feed snapshots on stop, before the database is closed
+	wikiFeed.Stop()
+	<-published
+	broker.Stop()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// publish is expvar.Publish for vars that may exist already, when run is
+// called more than once in tests.
+func publish(name string, f func() any) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(f))
+	}
+}
+
+// newClient configures a client for wiki from the environment, the diffs it
+// returns are ranked again by the rankers of timeframes.
+func newClient(wiki string, timeframes []feed.Timeframe) (*wiki_api.Client, error) {
+	client, err := wiki_api.New(wiki)
+	if err != nil {
+		return nil, err
+	}
+	client.Ranker = rankerFromEnv("WIDIFF_RANKER")
+	for _, t := range timeframes {
+		if t.Ranker != nil {
+			client.Rankers = append(client.Rankers, t.Ranker)
+		}
+	}
+	if err := filterConfigFromEnv().Apply(client); err != nil {
+		return nil, err
+	}
+	// point all wikis at a local MediaWiki stand-in or a recording proxy
+	if apiURL := os.Getenv("WIDIFF_API_URL"); apiURL != "" {
+		client.BaseURL = apiURL
+	}
+	return client, nil
+}
+
+// newSource polls the action API unless stream is set, then wiki is fed
+// from the stream.
+func newSource(wiki string, stream *wiki_api.Stream, timeframes []feed.Timeframe) (*wiki_api.Client, feed.WikiSource, error) {
+	client, err := newClient(wiki, timeframes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream == nil {
+		return client, client, nil
+	}
+	source, err := stream.Source(client)
+	if err != nil {
+		return nil, nil, err
 	}
+	return client, source, nil
 }
@@ -2,7 +2,7 @@ set -euo pipefail
 
 export $(xargs -a ../.env)
 
-go run main.go
+go run -tags sqlite_fts5 .
 
 unset $(xargs -a ../.env | sed 's/=.*//')
 
@@ -4,32 +4,55 @@ document.addEventListener('DOMContentLoaded', function () {
     const diffCommentDiv = document.getElementById('diff-comment');
     const diffUserFooter = document.getElementById('diff-user');
     const outputformatSelect = document.getElementById('output-format')
-    const diffCache = {}; // Store fetched diffs
+    const leaderboardList = document.getElementById('leaderboard');
+    let diffCache = {}; // Store fetched diffs by window name
+    let leaderboardCache = {}; // Runners-up by window name, best first
+    let selectedRank = 0; // Leaderboard entry on display
+    const params = new URLSearchParams(window.location.search);
+    const wiki = params.get('wiki') || 'enwiki';
+    const permalinkId = params.get('id'); // Shared link to a stored diff
+    let permalink = null;
+
+    // Populate the timeframe select with the windows configured on the server
+    async function fetchWindows() {
+        try {
+            const response = await fetch('/windows');
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            const windows = await response.json();
+            timeframeSelect.replaceChildren(...windows.map((w) => {
+                const option = document.createElement('option');
+                option.value = w.name;
+                option.textContent = `Last ${w.name}`;
+                return option;
+            }));
+        } catch (error) {
+            console.error('Error fetching windows:', error);
+        }
+    }
 
     // Fetch all diffs on page load
     async function fetchAllDiffs() {
         try {
-            const response = await fetch('/diff');
+            const response = await fetch(`/diff?wiki=${encodeURIComponent(wiki)}`);
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
             const data = await response.json();
 
-            // Assuming the server returns JSON like this:
+            // The server returns JSON like this:
             // {
-            //  "minute": "diff string for minute",
-            //  "hour": "diff string for hour",
-            //  "day": "diff string for day"
+            //  "wiki": "enwiki",
+            //  "windows": {"minute": {diffstring, comment, ...}, "hour": ...}
             // }
 
-            diffCache.minute = data.minute || null; // Store diff in cache
-            diffCache.hour = data.hour || null; // Store diff in cache
-            diffCache.day = data.day || null; // Store diff in cache
+            diffCache = data.windows || {}; // Store diffs in cache
+            leaderboardCache = data.leaderboards || {};
         } catch (error) {
             console.error('Error fetching all diffs:', error);
-            diffCache.minute = null;
-            diffCache.hour = null;
-            diffCache.day = null;
+            diffCache = {};
+            leaderboardCache = {};
         }
 
         // Display initial diff after all fetches are complete
@@ -41,8 +64,31 @@ document.addEventListener('DOMContentLoaded', function () {
         return `${comment}\n\u2014${user}`
     }
 
+    function renderLeaderboard(timeframe) {
+        const entries = leaderboardCache[timeframe] || [];
+        leaderboardList.replaceChildren(...entries.map((entry, rank) => {
+            const item = document.createElement('li');
+            item.textContent = `${entry.title || 'untitled'} (${entry.size} bytes) \u2014 ${entry.user}`;
+            if (rank === selectedRank) {
+                item.classList.add('selected');
+            }
+            item.addEventListener('click', () => {
+                selectedRank = rank;
+                displayDiff(timeframeSelect.value, outputformatSelect.value);
+            });
+            return item;
+        }));
+    }
+
     function displayDiff(timeframe, format) {
-        const { diffstring, comment, user, review } = diffCache[timeframe];
+        renderLeaderboard(timeframe);
+        const entries = leaderboardCache[timeframe] || [];
+        const selected = permalink || entries[selectedRank] || diffCache[timeframe];
+        if (!selected) {
+            diffOutputDiv.textContent = `Failed to load diff for ${timeframe}.`;
+            return;
+        }
+        const { diffstring, comment, user, review, review_pending } = selected;
         if (diffstring === null) {
             diffOutputDiv.textContent = `Failed to load diff for ${timeframe}.`;
             return;
@@ -68,7 +114,9 @@ document.addEventListener('DOMContentLoaded', function () {
             }
         );
         diffUserFooter.textContent = `\u2014 ${user}`;
-        diffCommentDiv.textContent = review.replace(/\\n/g, '\n');
+        diffCommentDiv.textContent = review_pending
+            ? 'Review pending\u2026'
+            : review.replace(/\\n/g, '\n');
         diffCommentDiv.appendChild(diffUserFooter);
         diff2htmlUi.draw();
 
@@ -80,9 +128,11 @@ document.addEventListener('DOMContentLoaded', function () {
         evtSource.onmessage = (event) => {
             update = JSON.parse(event.data);
             console.log(update)
-            diffCache.minute = update.minute || null; // Store diff in cache
-            diffCache.hour = update.hour || null; // Store diff in cache
-            diffCache.day = update.day || null; // Store diff in cache
+            if (update.wiki !== wiki) {
+                return;
+            }
+            diffCache = update.windows || {}; // Store diffs in cache
+            leaderboardCache = update.leaderboards || {};
             displayDiff(timeframeSelect.value, outputformatSelect.value);
         }
         evtSource.onerror = (error) => {
@@ -95,6 +145,7 @@ document.addEventListener('DOMContentLoaded', function () {
     // Listen for timeframe changes
     timeframeSelect.addEventListener('change', function () {
         const selectedTimeframe = timeframeSelect.value;
+        selectedRank = 0;
         displayDiff(selectedTimeframe, outputformatSelect.value); // Display diff from cache
     });
 
@@ -103,6 +154,26 @@ document.addEventListener('DOMContentLoaded', function () {
         displayDiff(timeframeSelect.value, selectedFormat);
     })
 
+    // Show a single stored diff instead of the live feed
+    async function fetchPermalink() {
+        try {
+            const response = await fetch(`/api/diffs/${encodeURIComponent(permalinkId)}`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            permalink = await response.json();
+        } catch (error) {
+            console.error('Error fetching diff:', error);
+            diffOutputDiv.textContent = `Failed to load diff ${permalinkId}.`;
+            return;
+        }
+        displayDiff(timeframeSelect.value, outputformatSelect.value);
+    }
+
+    if (permalinkId) {
+        fetchPermalink();
+        return;
+    }
     src = initEventSource();
-    fetchAllDiffs();
+    fetchWindows().then(fetchAllDiffs);
 });
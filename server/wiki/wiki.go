@@ -3,6 +3,9 @@ package wiki
 import (
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -14,27 +17,65 @@ type CompareRequest struct {
 	ToRevId   string
 }
 
-const actionPrefix = "https://en.wikipedia.org/w/api.php?action="
+// Sites maps wiki ids, as used by EventStreams and the /diff?wiki= parameter,
+// to the host serving their action API.
+var Sites = map[string]string{
+	"enwiki":       "en.wikipedia.org",
+	"dewiki":       "de.wikipedia.org",
+	"frwiki":       "fr.wikipedia.org",
+	"jawiki":       "ja.wikipedia.org",
+	"enwiktionary": "en.wiktionary.org",
+	"wikidatawiki": "www.wikidata.org",
+}
+
+func Host(wikiID string) (string, error) {
+	host, ok := Sites[wikiID]
+	if !ok {
+		return "", fmt.Errorf("unknown wiki %q", wikiID)
+	}
+	return host, nil
+}
+
+// APIURL returns the action API endpoint of a wiki.
+func APIURL(wikiID string) (string, error) {
+	host, err := Host(wikiID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s/w/api.php", host), nil
+}
+
+func buildURL(baseURL string, query url.Values) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		log.Printf("invalid api url %q: %s", baseURL, err)
+		return baseURL + "?" + query.Encode()
+	}
+	q := u.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
 
-// TODO: use url.URL
-func (cr *CompareRequest) URL() string {
+func (cr *CompareRequest) URL(baseURL string) string {
 	title := strings.Replace(cr.FromTitle, " ", "_", -1)
 
-	var b strings.Builder
-	b.WriteString(actionPrefix)
-	b.WriteString("compare")
-	b.WriteString("&format=json")
-	b.WriteString(fmt.Sprintf("&fromtitle=%s", title))
-	b.WriteString(fmt.Sprintf("&fromrev=%s", cr.FromRevId))
-	b.WriteString(fmt.Sprintf("&totitle=%s", title))
-	b.WriteString(fmt.Sprintf("&torev=%s", cr.ToRevId))
+	query := url.Values{}
+	query.Set("action", "compare")
+	query.Set("format", "json")
+	query.Set("fromtitle", title)
+	query.Set("fromrev", cr.FromRevId)
+	query.Set("totitle", title)
+	query.Set("torev", cr.ToRevId)
 
-	b.WriteString(fmt.Sprintf("&difftype=%s", "unified"))
-	b.WriteString(fmt.Sprintf("&utf8=%d", 1))
-	b.WriteString(fmt.Sprintf("&formatversion=%d", 2))
-	b.WriteString("&prop=diff%7Cids%7Ctitle%7Cuser%7Ccomment")
+	query.Set("difftype", "unified")
+	query.Set("utf8", "1")
+	query.Set("formatversion", "2")
+	query.Set("prop", "diff|ids|title|user|comment")
 
-	return b.String()
+	return buildURL(baseURL, query)
 }
 
 type CompareResponse struct {
@@ -56,21 +97,80 @@ type Comparison struct {
 	ToComment string `json:"tocomment"`
 }
 
+// RecentChangeLimit is the largest rclimit allowed for non-bot clients.
+const RecentChangeLimit = 500
+
+// RecentChangeRequest lists changes between RcStart and RcEnd. The API walks
+// from newer to older, so RcStart is the later timestamp. A zero RcStart
+// means "now".
 type RecentChangeRequest struct {
-	RcEnd time.Time
+	RcStart time.Time
+	RcEnd   time.Time
+	Limit   int
+	// Continue is the continuation returned with the previous page, nil for
+	// the first page
+	Continue *Continue
+	// Namespaces defaults to the main namespace
+	Namespaces []int
+	// AllNamespaces leaves out rcnamespace, Namespaces is ignored
+	AllNamespaces bool
+	// Show is passed as rcshow, e.g. "!bot"
+	Show []string
 }
 
-func (rc *RecentChangeRequest) URL() string {
+func (rc *RecentChangeRequest) URL(baseURL string) string {
 	timeString := rc.RcEnd.UTC().Format(time.RFC3339)
 	log.Printf("getting changes starting from %s\n", timeString)
 
-	url := "https://en.wikipedia.org/w/api.php?action=query&format=json&list=recentchanges&formatversion=2&rcnamespace=0&rcprop=title%7Ctimestamp%7Cids%7Csizes%7Cparsedcomment%7Ccomment&rclimit=500&rctype=edit"
-	url += fmt.Sprintf("&rcend=%s", timeString)
-	return url
+	limit := rc.Limit
+	if limit <= 0 || limit > RecentChangeLimit {
+		limit = RecentChangeLimit
+	}
+
+	query := url.Values{}
+	query.Set("action", "query")
+	query.Set("format", "json")
+	query.Set("list", "recentchanges")
+	query.Set("formatversion", "2")
+	if !rc.AllNamespaces {
+		namespaces := []string{"0"}
+		if len(rc.Namespaces) > 0 {
+			namespaces = namespaces[:0]
+			for _, ns := range rc.Namespaces {
+				namespaces = append(namespaces, strconv.Itoa(ns))
+			}
+		}
+		query.Set("rcnamespace", strings.Join(namespaces, "|"))
+	}
+	query.Set("rcprop", "title|timestamp|ids|sizes|parsedcomment|comment|user|flags|tags")
+	if len(rc.Show) > 0 {
+		query.Set("rcshow", strings.Join(rc.Show, "|"))
+	}
+	query.Set("rctype", "edit")
+	query.Set("rclimit", strconv.Itoa(limit))
+	query.Set("rcend", timeString)
+	if !rc.RcStart.IsZero() {
+		query.Set("rcstart", rc.RcStart.UTC().Format(time.RFC3339))
+	}
+	if rc.Continue != nil {
+		// both values are sent back as returned
+		query.Set("rccontinue", rc.Continue.RcContinue)
+		query.Set("continue", rc.Continue.Continue)
+	}
+
+	return buildURL(baseURL, query)
 }
 
 type RecentChangesResponse struct {
-	Query Query `json:"query"`
+	Continue *Continue `json:"continue"`
+	Query    Query     `json:"query"`
+}
+
+// Continue is present when more results are available.
+// https://www.mediawiki.org/wiki/API:Continue
+type Continue struct {
+	RcContinue string `json:"rccontinue"`
+	Continue   string `json:"continue"`
 }
 
 type Query struct {
@@ -78,16 +178,116 @@ type Query struct {
 }
 
 type RecentChange struct {
-	Type          string `json:"type"`
-	Ns            int    `json:"ns"`
-	Title         string `json:"title"`
-	PageID        int    `json:"pageid"` // pageid can be used as curid https://en.wikipedia.org/wiki/?curid=31388
-	RevID         int    `json:"revid"`
-	OldRevID      int    `json:"old_revid"`
-	Rcid          int    `json:"rcid"`
-	OldLen        int    `json:"oldlen"`
-	NewLen        int    `json:"newlen"`
-	Timestamp     string `json:"timestamp"`
-	Comment       string `json:"comment"`
-	ParsedComment string `json:"parsedcomment"`
+	Type          string   `json:"type"`
+	Ns            int      `json:"ns"`
+	Title         string   `json:"title"`
+	PageID        int      `json:"pageid"` // pageid can be used as curid https://en.wikipedia.org/wiki/?curid=31388
+	RevID         int      `json:"revid"`
+	OldRevID      int      `json:"old_revid"`
+	Rcid          int      `json:"rcid"`
+	OldLen        int      `json:"oldlen"`
+	NewLen        int      `json:"newlen"`
+	Timestamp     string   `json:"timestamp"`
+	Comment       string   `json:"comment"`
+	ParsedComment string   `json:"parsedcomment"`
+	User          string   `json:"user"`
+	Bot           bool     `json:"bot"`
+	Minor         bool     `json:"minor"`
+	Anon          bool     `json:"anon"`
+	Tags          []string `json:"tags"`
+}
+
+// RecentChangeEvent is a single message of the EventStreams recentchange stream.
+// https://stream.wikimedia.org/?doc#/streams/get_v2_stream_recentchange
+type RecentChangeEvent struct {
+	ID            int      `json:"id"`
+	Type          string   `json:"type"`
+	Namespace     int      `json:"namespace"`
+	Title         string   `json:"title"`
+	Comment       string   `json:"comment"`
+	ParsedComment string   `json:"parsedcomment"`
+	Timestamp     int64    `json:"timestamp"`
+	User          string   `json:"user"`
+	Bot           bool     `json:"bot"`
+	Minor         bool     `json:"minor"`
+	Length        Length   `json:"length"`
+	Revision      Revision `json:"revision"`
+	ServerName    string   `json:"server_name"`
+	Wiki          string   `json:"wiki"`
+}
+
+type Length struct {
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+type Revision struct {
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// RecentChange converts the event into the shape returned by list=recentchanges.
+func (e RecentChangeEvent) RecentChange() RecentChange {
+	return RecentChange{
+		Type:          e.Type,
+		Ns:            e.Namespace,
+		Title:         e.Title,
+		RevID:         e.Revision.New,
+		OldRevID:      e.Revision.Old,
+		Rcid:          e.ID,
+		OldLen:        e.Length.Old,
+		NewLen:        e.Length.New,
+		Timestamp:     time.Unix(e.Timestamp, 0).UTC().Format(time.RFC3339),
+		Comment:       e.Comment,
+		ParsedComment: e.ParsedComment,
+		User:          e.User,
+		Bot:           e.Bot,
+		Minor:         e.Minor,
+		// the stream has no anon flag, logged out edits are attributed to an IP
+		Anon: net.ParseIP(e.User) != nil,
+	}
+}
+
+// PageViewsRequest asks for the daily views of up to 50 pages.
+// https://www.mediawiki.org/wiki/Extension:PageViewInfo
+type PageViewsRequest struct {
+	Titles []string
+	Days   int
+}
+
+func (pr *PageViewsRequest) URL(baseURL string) string {
+	query := url.Values{}
+	query.Set("action", "query")
+	query.Set("format", "json")
+	query.Set("formatversion", "2")
+	query.Set("prop", "pageviews")
+	query.Set("titles", strings.Join(pr.Titles, "|"))
+	if pr.Days > 0 {
+		query.Set("pvipdays", strconv.Itoa(pr.Days))
+	}
+	return buildURL(baseURL, query)
+}
+
+type PageViewsResponse struct {
+	Query PageViewsQuery `json:"query"`
+}
+
+type PageViewsQuery struct {
+	Pages []PageViews `json:"pages"`
+}
+
+type PageViews struct {
+	Title string `json:"title"`
+	// Views maps days to views, days without data are null
+	Views map[string]*int `json:"pageviews"`
+}
+
+func (pv PageViews) Total() int {
+	total := 0
+	for _, views := range pv.Views {
+		if views != nil {
+			total += *views
+		}
+	}
+	return total
 }
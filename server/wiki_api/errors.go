@@ -0,0 +1,128 @@
+package wiki_api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoChanges means the window held no change to compare, as opposed to
+// changes that could not be fetched or compared.
+var ErrNoChanges = errors.New("no changes")
+
+// TransportError means no usable HTTP response was received, either because
+// the request failed or because the server answered with an error status.
+type TransportError struct {
+	URL        string
+	StatusCode int
+	Body       []byte
+	Err        error
+}
+
+func (e *TransportError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("status code request: %v", e.StatusCode)
+	}
+	return fmt.Sprintf("error on GET request: %v", e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// ContentTypeError means the server answered with something other than JSON,
+// usually an HTML error page.
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+	Body        []byte
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("did not receive json response, received: %s", e.ContentType)
+}
+
+// APIError is the error object MediaWiki returns in place of a result.
+// https://www.mediawiki.org/wiki/API:Errors_and_warnings
+type APIError struct {
+	URL  string  `json:"-"`
+	Code string  `json:"code"`
+	Info string  `json:"info"`
+	Lag  float64 `json:"lag"`
+	Body []byte  `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %s: %s", e.Code, e.Info)
+}
+
+// DecodeError means the response was JSON but not in the expected shape.
+type DecodeError struct {
+	URL  string
+	Body []byte
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("error unmarshaling json: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EmptyDiffError means the comparison succeeded but contained no diff text,
+// e.g. for suppressed or null revisions.
+type EmptyDiffError struct {
+	Title     string
+	FromRevID int
+	ToRevID   int
+}
+
+func (e *EmptyDiffError) Error() string {
+	return fmt.Sprintf("empty diff for %s (%d..%d)", e.Title, e.FromRevID, e.ToRevID)
+}
+
+// revisionCodes are the API error codes of compares that fail for the
+// compared revision only. Others, e.g. maxlag or ratelimited, would fail for
+// every candidate.
+var revisionCodes = map[string]bool{
+	"nosuchrevid":    true,
+	"missingcontent": true,
+	"missingtitle":   true,
+	"revdeleted":     true,
+	"suppressed":     true,
+}
+
+// Skippable reports whether err is specific to the compared revision, so
+// trying another candidate of the same window may succeed.
+func Skippable(err error) bool {
+	var contentErr *ContentTypeError
+	var apiErr *APIError
+	var decodeErr *DecodeError
+	var emptyErr *EmptyDiffError
+	if errors.As(err, &apiErr) {
+		return revisionCodes[apiErr.Code]
+	}
+	return errors.As(err, &contentErr) ||
+		errors.As(err, &decodeErr) ||
+		errors.As(err, &emptyErr)
+}
+
+// RawBody returns the response body captured by err, if any.
+func RawBody(err error) []byte {
+	var transportErr *TransportError
+	var contentErr *ContentTypeError
+	var apiErr *APIError
+	var decodeErr *DecodeError
+	switch {
+	case errors.As(err, &transportErr):
+		return transportErr.Body
+	case errors.As(err, &contentErr):
+		return contentErr.Body
+	case errors.As(err, &apiErr):
+		return apiErr.Body
+	case errors.As(err, &decodeErr):
+		return decodeErr.Body
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package wiki_api
+
+import (
+	"regexp"
+	"slices"
+	"widiff/wiki"
+)
+
+// Filter reports whether a change may become a candidate.
+type Filter func(wiki.RecentChange) bool
+
+// Filters is a pipeline, a change has to pass every filter.
+type Filters []Filter
+
+func (fs Filters) Apply(changes []wiki.RecentChange) []wiki.RecentChange {
+	if len(fs) == 0 {
+		return changes
+	}
+	kept := make([]wiki.RecentChange, 0, len(changes))
+	for _, change := range changes {
+		if fs.keep(change) {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
+
+func (fs Filters) keep(change wiki.RecentChange) bool {
+	for _, f := range fs {
+		if !f(change) {
+			return false
+		}
+	}
+	return true
+}
+
+func ExcludeBots() Filter {
+	return func(c wiki.RecentChange) bool {
+		return !c.Bot
+	}
+}
+
+func ExcludeAnonymous() Filter {
+	return func(c wiki.RecentChange) bool {
+		return !c.Anon
+	}
+}
+
+func ExcludeMinor() Filter {
+	return func(c wiki.RecentChange) bool {
+		return !c.Minor
+	}
+}
+
+// ExcludeTags drops changes carrying any of tags, e.g. mw-reverted or
+// mw-rollback.
+func ExcludeTags(tags ...string) Filter {
+	return func(c wiki.RecentChange) bool {
+		for _, tag := range c.Tags {
+			if slices.Contains(tags, tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func IncludeNamespaces(namespaces ...int) Filter {
+	return func(c wiki.RecentChange) bool {
+		return slices.Contains(namespaces, c.Ns)
+	}
+}
+
+func ExcludeNamespaces(namespaces ...int) Filter {
+	return func(c wiki.RecentChange) bool {
+		return !slices.Contains(namespaces, c.Ns)
+	}
+}
+
+func TitleMatches(re *regexp.Regexp) Filter {
+	return func(c wiki.RecentChange) bool {
+		return re.MatchString(c.Title)
+	}
+}
+
+func TitleNotMatches(re *regexp.Regexp) Filter {
+	return func(c wiki.RecentChange) bool {
+		return !re.MatchString(c.Title)
+	}
+}
+
+// FilterConfig describes a filter pipeline and the server side filtering
+// that goes with it.
+type FilterConfig struct {
+	ExcludeBots       bool
+	ExcludeAnonymous  bool
+	ExcludeMinor      bool
+	ExcludeTags       []string
+	IncludeNamespaces []int
+	ExcludeNamespaces []int
+	// TitlePattern keeps matching titles, ExcludeTitlePattern drops them
+	TitlePattern        string
+	ExcludeTitlePattern string
+}
+
+func (fc FilterConfig) Filters() (Filters, error) {
+	var fs Filters
+	if fc.ExcludeBots {
+		fs = append(fs, ExcludeBots())
+	}
+	if fc.ExcludeAnonymous {
+		fs = append(fs, ExcludeAnonymous())
+	}
+	if fc.ExcludeMinor {
+		fs = append(fs, ExcludeMinor())
+	}
+	if len(fc.ExcludeTags) > 0 {
+		fs = append(fs, ExcludeTags(fc.ExcludeTags...))
+	}
+	if len(fc.IncludeNamespaces) > 0 {
+		fs = append(fs, IncludeNamespaces(fc.IncludeNamespaces...))
+	}
+	if len(fc.ExcludeNamespaces) > 0 {
+		fs = append(fs, ExcludeNamespaces(fc.ExcludeNamespaces...))
+	}
+	if fc.TitlePattern != "" {
+		re, err := regexp.Compile(fc.TitlePattern)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, TitleMatches(re))
+	}
+	if fc.ExcludeTitlePattern != "" {
+		re, err := regexp.Compile(fc.ExcludeTitlePattern)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, TitleNotMatches(re))
+	}
+	return fs, nil
+}
+
+// Show returns the rcshow values that let the API drop excluded changes
+// before they are paginated.
+func (fc FilterConfig) Show() []string {
+	var show []string
+	if fc.ExcludeBots {
+		show = append(show, "!bot")
+	}
+	if fc.ExcludeAnonymous {
+		show = append(show, "!anon")
+	}
+	if fc.ExcludeMinor {
+		show = append(show, "!minor")
+	}
+	return show
+}
+
+// Apply configures client to request and filter changes accordingly.
+func (fc FilterConfig) Apply(client *Client) error {
+	filters, err := fc.Filters()
+	if err != nil {
+		return err
+	}
+	client.Filters = filters
+	client.Show = fc.Show()
+	client.Namespaces = fc.IncludeNamespaces
+	// the API can not exclude namespaces, the filters drop them instead
+	client.AllNamespaces = len(fc.IncludeNamespaces) == 0 && len(fc.ExcludeNamespaces) > 0
+	client.FiltersTags = len(fc.ExcludeTags) > 0
+	return nil
+}
@@ -0,0 +1,55 @@
+package wiki_api
+
+import (
+	"fmt"
+	"testing"
+	"widiff/wiki"
+)
+
+func TestFilterConfig(t *testing.T) {
+	changes := []wiki.RecentChange{
+		{Rcid: 1, Title: "Bot run", Bot: true},
+		{Rcid: 2, Title: "Reverted", Tags: []string{"mw-reverted"}},
+		{Rcid: 3, Title: "Talk:Page", Ns: 1},
+		{Rcid: 4, Title: "List of things"},
+		{Rcid: 5, Title: "Page", User: "127.0.0.1", Anon: true},
+		{Rcid: 6, Title: "Page", Tags: []string{"mobile edit"}},
+	}
+
+	fc := FilterConfig{
+		ExcludeBots:         true,
+		ExcludeTags:         []string{"mw-reverted", "mw-rollback"},
+		ExcludeNamespaces:   []int{1},
+		ExcludeTitlePattern: "^List of",
+	}
+	filters, err := fc.Filters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kept []int
+	for _, c := range filters.Apply(changes) {
+		kept = append(kept, c.Rcid)
+	}
+	expected := []int{5, 6}
+	if fmt.Sprint(kept) != fmt.Sprint(expected) {
+		t.Errorf("wrong changes kept, expected=%v, got=%v", expected, kept)
+	}
+
+	if show := fmt.Sprint(fc.Show()); show != "[!bot]" {
+		t.Errorf("wrong rcshow, expected=%s, got=%s", "[!bot]", show)
+	}
+
+	// exclusions alone request every namespace and filter client side
+	client := &Client{}
+	if err := fc.Apply(client); err != nil {
+		t.Fatal(err)
+	}
+	if !client.AllNamespaces {
+		t.Errorf("expected all namespaces with exclusions only")
+	}
+	fc.IncludeNamespaces = []int{0, 4}
+	if err := fc.Apply(client); err != nil || client.AllNamespaces {
+		t.Errorf("expected rcnamespace with an include list, got=%v", err)
+	}
+}
@@ -16,14 +16,18 @@ func ParseDiffText(c wiki.Comparison) (string, error) {
 	var builder strings.Builder
 	builder.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n\n", c.FromTitle, c.FromTitle))
 
+	if c.Body == "" {
+		return "", &EmptyDiffError{Title: c.FromTitle, FromRevID: c.FromRevID, ToRevID: c.ToRevID}
+	}
+
 	diff, ok := strings.CutPrefix(c.Body, htmlPrefix)
 	if !ok {
-		return "", fmt.Errorf("could not strip prefix")
+		return "", &DecodeError{Body: []byte(c.Body), Err: fmt.Errorf("could not strip prefix")}
 	}
 
 	diff, ok = strings.CutSuffix(diff, htmlSuffix)
 	if !ok {
-		return "", fmt.Errorf("could not strip suffix")
+		return "", &DecodeError{Body: []byte(c.Body), Err: fmt.Errorf("could not strip suffix")}
 	}
 	builder.WriteString(diff)
 
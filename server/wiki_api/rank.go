@@ -0,0 +1,229 @@
+package wiki_api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"widiff/wiki"
+)
+
+// Ranker decides what the "largest" edit is. Higher scores win.
+type Ranker interface {
+	Name() string
+	Score(c Candidate) float64
+}
+
+// DiffRanker is a Ranker that can only score candidates that have been
+// compared. The top candidates by byte delta and by page length are
+// compared and the best scored diff wins, see diffPool.
+type DiffRanker interface {
+	Ranker
+	NeedsDiff()
+}
+
+// ViewsRanker is a Ranker that needs page views, see Candidate.Views.
+type ViewsRanker interface {
+	Ranker
+	NeedsViews()
+}
+
+// Candidate is a change considered for the top diff of a window.
+type Candidate struct {
+	Change wiki.RecentChange
+	// Lines is nil until the change has been compared
+	Lines *LineStats
+	// Views are the page views of the last PageViewDays days
+	Views int
+}
+
+// LineStats counts the changed lines of a unified diff.
+type LineStats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+func CountLines(unified string) LineStats {
+	var stats LineStats
+	for _, line := range strings.Split(unified, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			stats.Added++
+		case strings.HasPrefix(line, "-"):
+			stats.Removed++
+		}
+	}
+	return stats
+}
+
+type ByteDelta struct{}
+
+func (ByteDelta) Name() string { return "bytes" }
+
+func (ByteDelta) Score(c Candidate) float64 {
+	return float64(Abs(c.Change.OldLen - c.Change.NewLen))
+}
+
+type AddedBytes struct{}
+
+func (AddedBytes) Name() string { return "added" }
+
+func (AddedBytes) Score(c Candidate) float64 {
+	return float64(max(c.Change.NewLen-c.Change.OldLen, 0))
+}
+
+type RemovedBytes struct{}
+
+func (RemovedBytes) Name() string { return "removed" }
+
+func (RemovedBytes) Score(c Candidate) float64 {
+	return float64(max(c.Change.OldLen-c.Change.NewLen, 0))
+}
+
+// ChangedLines ranks by added plus removed lines of the actual diff, so a
+// rewrite with net-zero size still counts.
+type ChangedLines struct{}
+
+func (ChangedLines) Name() string { return "lines" }
+
+func (ChangedLines) NeedsDiff() {}
+
+func (ChangedLines) Score(c Candidate) float64 {
+	if c.Lines == nil {
+		return 0
+	}
+	return float64(c.Lines.Added + c.Lines.Removed)
+}
+
+// Popularity weights Base by the logarithm of the page views.
+type Popularity struct {
+	Base Ranker
+}
+
+func (p Popularity) Name() string { return "popular-" + p.Base.Name() }
+
+func (Popularity) NeedsViews() {}
+
+func (p Popularity) Score(c Candidate) float64 {
+	return p.Base.Score(c) * math.Log2(2+float64(c.Views))
+}
+
+// RankerByName returns one of the built-in rankers: bytes, added, removed,
+// lines or popular, which weights bytes by views. popular-<base> weights
+// another ranker, as returned by Popularity.Name.
+func RankerByName(name string) (Ranker, error) {
+	if base, ok := strings.CutPrefix(name, "popular-"); ok && base != "" {
+		ranker, err := RankerByName(base)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ranker.(ViewsRanker); ok {
+			return nil, fmt.Errorf("unknown ranker %q", name)
+		}
+		return Popularity{Base: ranker}, nil
+	}
+	switch name {
+	case "", "bytes":
+		return ByteDelta{}, nil
+	case "added":
+		return AddedBytes{}, nil
+	case "removed":
+		return RemovedBytes{}, nil
+	case "lines":
+		return ChangedLines{}, nil
+	case "popular":
+		return Popularity{Base: ByteDelta{}}, nil
+	}
+	return nil, fmt.Errorf("unknown ranker %q", name)
+}
+
+// Rank orders candidates from highest to lowest score.
+func Rank(ranker Ranker, candidates []Candidate) []Candidate {
+	ranked := slices.Clone(candidates)
+	slices.SortStableFunc(ranked, func(a, b Candidate) int {
+		return cmp.Compare(ranker.Score(b), ranker.Score(a))
+	})
+	return ranked
+}
+
+// pageLength scores the larger revision of a change, which bounds how much
+// of the page the change can touch whatever its net size.
+type pageLength struct{}
+
+func (pageLength) Name() string { return "length" }
+
+func (pageLength) Score(c Candidate) float64 {
+	return float64(max(c.Change.OldLen, c.Change.NewLen))
+}
+
+// diffPool picks the n largest candidates by byte delta and adds the n on
+// the longest pages, so a rewrite with net-zero size is compared too.
+func diffPool(candidates []Candidate, n int) []Candidate {
+	type edit struct {
+		title string
+		revID int
+	}
+	seen := make(map[edit]bool)
+	var pool []Candidate
+	for _, ranker := range []Ranker{ByteDelta{}, pageLength{}} {
+		ranked := Rank(ranker, candidates)
+		for _, c := range ranked[:min(n, len(ranked))] {
+			key := edit{c.Change.Title, c.Change.RevID}
+			if !seen[key] {
+				seen[key] = true
+				pool = append(pool, c)
+			}
+		}
+	}
+	return pool
+}
+
+func toCandidates(changes []wiki.RecentChange) []Candidate {
+	candidates := make([]Candidate, len(changes))
+	for i, change := range changes {
+		candidates[i] = Candidate{Change: change}
+	}
+	return candidates
+}
+
+// PageViewDays is how many days of page views the Popularity ranker sums.
+const PageViewDays = 7
+
+// popularityPool is how many of the largest changes get their views looked
+// up, one request covers 50 titles.
+const popularityPool = 50
+
+// addViews looks up the page views of the largest candidates and drops the
+// rest, which would be ranked on missing data otherwise.
+func (c *Client) addViews(ctx context.Context, candidates []Candidate) ([]Candidate, error) {
+	pool := Rank(ByteDelta{}, candidates)
+	pool = pool[:min(popularityPool, len(pool))]
+
+	titles := make([]string, 0, len(pool))
+	for _, candidate := range pool {
+		titles = append(titles, candidate.Change.Title)
+	}
+	pvReq := wiki.PageViewsRequest{Titles: titles, Days: PageViewDays}
+	url := pvReq.URL(c.BaseURL)
+	body, _, err := c.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	var pvResp wiki.PageViewsResponse
+	if err := json.Unmarshal(body, &pvResp); err != nil {
+		return nil, &DecodeError{URL: url, Body: body, Err: err}
+	}
+
+	views := make(map[string]int, len(pvResp.Query.Pages))
+	for _, page := range pvResp.Query.Pages {
+		views[page.Title] = page.Total()
+	}
+	for i := range pool {
+		pool[i].Views = views[pool[i].Change.Title]
+	}
+	return pool, nil
+}
@@ -0,0 +1,168 @@
+package wiki_api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"widiff/wiki"
+)
+
+func TestRankers(t *testing.T) {
+	candidates := toCandidates([]wiki.RecentChange{
+		{Rcid: 1, OldLen: 100, NewLen: 50000},
+		{Rcid: 2, OldLen: 90000, NewLen: 100},
+		{Rcid: 3, OldLen: 100, NewLen: 300},
+	})
+
+	tests := []struct {
+		ranker   Ranker
+		expected []int
+	}{
+		{ByteDelta{}, []int{2, 1, 3}},
+		{AddedBytes{}, []int{1, 3, 2}},
+		{RemovedBytes{}, []int{2, 1, 3}},
+	}
+	for _, tt := range tests {
+		var actual []int
+		for _, c := range Rank(tt.ranker, candidates) {
+			actual = append(actual, c.Change.Rcid)
+		}
+		if fmt.Sprint(actual) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong order for %s, expected=%v, got=%v", tt.ranker.Name(), tt.expected, actual)
+		}
+	}
+}
+
+func TestRankerNames(t *testing.T) {
+	for _, name := range []string{"bytes", "added", "removed", "lines", "popular", "popular-lines"} {
+		ranker, err := RankerByName(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		// names are stored and shown, they have to parse again
+		again, err := RankerByName(ranker.Name())
+		if err != nil || again != ranker {
+			t.Errorf("%s does not round-trip, expected=%v, got=%v (%v)", ranker.Name(), ranker, again, err)
+		}
+	}
+	for _, name := range []string{"views", "popular-", "popular-popular-bytes", "popular-views"} {
+		if _, err := RankerByName(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestTimeframeRankerLooksUpViews(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.URL.Query().Get("prop") == "pageviews" {
+			fmt.Fprint(w, `{"query":{"pages":[{"title":"Page","pageviews":{"2026-10-01":40,"2026-10-02":2}}]}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"compare":{"fromtitle":"Page","body":%q}}`, "<tr><td colspan=\"4\"><pre>@@ -1 +1 @@\n-a\n+b</pre></td></tr>")
+	}))
+	defer server.Close()
+
+	// the client ranks by bytes, the hour by popularity
+	client := &Client{BaseURL: server.URL, MaxCandidates: 1, Rankers: []Ranker{Popularity{Base: ByteDelta{}}}}
+	diff, err := client.compareCandidates(context.Background(), []wiki.RecentChange{
+		{Title: "Page", RevID: 1, OldLen: 100, NewLen: 300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Views != 42 {
+		t.Errorf("wrong views, expected=%d, got=%d", 42, diff.Views)
+	}
+}
+
+func TestChangedLinesComparesCandidates(t *testing.T) {
+	bodies := map[string]string{
+		// page blanking: large byte delta, one changed line
+		"1": "@@ -1 +0,0 @@\n-blanked",
+		// rewrite with net-zero size
+		"2": "@@ -1,3 +1,3 @@\n-a\n-b\n-c\n+d\n+e\n+f",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		body := fmt.Sprintf("<tr><td colspan=\"4\"><pre>%s</pre></td></tr>", bodies[r.URL.Query().Get("torev")])
+		fmt.Fprintf(w, `{"compare":{"fromtitle":"Page","body":%q}}`, body)
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, MaxCandidates: 2, Ranker: ChangedLines{}}
+	diff, err := client.compareCandidates(context.Background(), []wiki.RecentChange{
+		{Title: "Blanked", RevID: 1, OldLen: 50000, NewLen: 0},
+		{Title: "Rewrite", RevID: 2, OldLen: 300, NewLen: 300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := LineStats{Added: 3, Removed: 3}
+	if diff.Change.RevID != 2 || diff.Lines != expected {
+		t.Errorf("wrong diff selected, expected=%+v, got=%+v (rev %d)", expected, diff.Lines, diff.Change.RevID)
+	}
+}
+
+func TestChangedLinesKeepsBestOnOutage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("torev") {
+		case "1":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprintf(w, `{"compare":{"fromtitle":"Page","body":%q}}`, "<tr><td colspan=\"4\"><pre>@@ -1 +1 @@\n-a\n+b</pre></td></tr>")
+		case "2":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"error":{"code":"nosuchrevid","info":"deleted"}}`)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, MaxCandidates: 3, Ranker: ChangedLines{}}
+	diff, err := client.compareCandidates(context.Background(), []wiki.RecentChange{
+		{Title: "Compared", RevID: 1, OldLen: 100, NewLen: 9000},
+		{Title: "Deleted", RevID: 2, OldLen: 100, NewLen: 8000},
+		{Title: "Outage", RevID: 3, OldLen: 100, NewLen: 7000},
+	})
+	if err != nil {
+		t.Fatalf("expected the compared diff, got=%v", err)
+	}
+	if diff.Change.RevID != 1 || len(diff.Skipped) != 1 || diff.Skipped[0].RevID != 2 {
+		t.Errorf("wrong diff, expected rev 1 skipping rev 2, got=%d %+v", diff.Change.RevID, diff.Skipped)
+	}
+}
+
+func TestChangedLinesComparesNetZeroRewrite(t *testing.T) {
+	bodies := map[string]string{
+		// an appended section: large byte delta, few lines
+		"1": "@@ -10,0 +11,2 @@\n+== Discography ==\n+a long table",
+		// rewrite of a long page with net-zero size
+		"2": "@@ -1,4 +1,4 @@\n-a\n-b\n-c\n-d\n+e\n+f\n+g\n+h",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		body := fmt.Sprintf("<tr><td colspan=\"4\"><pre>%s</pre></td></tr>", bodies[r.URL.Query().Get("torev")])
+		fmt.Fprintf(w, `{"compare":{"fromtitle":"Page","body":%q}}`, body)
+	}))
+	defer server.Close()
+
+	// a single candidate by byte delta would only compare the append
+	client := &Client{BaseURL: server.URL, MaxCandidates: 1, Ranker: ChangedLines{}}
+	diff, err := client.compareCandidates(context.Background(), []wiki.RecentChange{
+		{Title: "Appended", RevID: 1, OldLen: 1000, NewLen: 6000},
+		{Title: "Rewrite", RevID: 2, OldLen: 8000, NewLen: 8002},
+		{Title: "Typo", RevID: 3, OldLen: 100, NewLen: 101},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.Change.RevID != 2 {
+		t.Errorf("wrong diff selected, expected=%d, got=%d (%+v)", 2, diff.Change.RevID, diff.Lines)
+	}
+}
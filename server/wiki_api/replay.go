@@ -0,0 +1,180 @@
+package wiki_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Exchange is a request to the action API and its response.
+type Exchange struct {
+	// URL is the request path and query, without scheme and host
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	// Body holds JSON responses as they are, Text everything else
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+func (e Exchange) body() []byte {
+	if e.Body != nil {
+		return e.Body
+	}
+	return []byte(e.Text)
+}
+
+// Cassette is a sequence of exchanges, stored as JSON in testdata.
+//
+// The cassettes in testdata are synthetic: written by hand in this format
+// around made-up pages, revisions and editors, and named *.synthetic.json so
+// they are not taken for recordings. Replaying them checks the client
+// against the API as documented, not against its current behaviour. A
+// Recorder captures real exchanges, the replay tests write them to
+// <case>.json with -record.
+type Cassette struct {
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(b, &cassette); err != nil {
+		return nil, fmt.Errorf("error reading cassette %s: %v", path, err)
+	}
+	return &cassette, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	// keeps URLs and diff bodies readable
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
+
+// requestKey identifies a request independent of host and parameter order.
+func requestKey(u *url.URL) string {
+	return u.Path + "?" + u.Query().Encode()
+}
+
+// Recorder is a http.RoundTripper that passes requests on to Transport and
+// appends every exchange to Cassette.
+type Recorder struct {
+	// Transport defaults to http.DefaultTransport
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	Cassette Cassette
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	exchange := Exchange{
+		URL:         requestKey(req.URL),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if strings.Contains(exchange.ContentType, "application/json") && json.Valid(body) {
+		exchange.Body = json.RawMessage(body)
+	} else {
+		exchange.Text = string(body)
+	}
+	r.mu.Lock()
+	r.Cassette.Exchanges = append(r.Cassette.Exchanges, exchange)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Replayer is a http.RoundTripper that answers from a Cassette without
+// touching the network. Each exchange is used once, in recorded order, so
+// retried requests get their recorded retries.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{
+		exchanges: cassette.Exchanges,
+		used:      make([]bool, len(cassette.Exchanges)),
+	}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := requestKey(req.URL)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, exchange := range r.exchanges {
+		if r.used[i] || requestKey(parseURL(exchange.URL)) != key {
+			continue
+		}
+		r.used[i] = true
+		header := http.Header{}
+		if exchange.ContentType != "" {
+			header.Set("Content-Type", exchange.ContentType)
+		}
+		body := exchange.body()
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+			StatusCode:    exchange.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s", key)
+}
+
+// Unused returns the URLs of the exchanges that were not replayed.
+func (r *Replayer) Unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []string
+	for i, exchange := range r.exchanges {
+		if !r.used[i] {
+			unused = append(unused, exchange.URL)
+		}
+	}
+	return unused
+}
+
+func parseURL(rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &url.URL{Path: rawURL}
+	}
+	return u
+}
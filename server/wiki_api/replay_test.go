@@ -0,0 +1,234 @@
+package wiki_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"widiff/wiki"
+)
+
+// The cassettes in testdata are replayed by default, the committed ones are
+// synthetic, see Cassette. Recent changes are only kept for about 30 days, so
+// to record a real case move its window to the last days first, record it
+// into <case>.json, clear synthetic and update the expectations:
+//
+//	go test ./wiki_api -run TestReplay -record
+var (
+	record = flag.Bool("record", false, "record the cassettes from the live API into <case>.json")
+	update = flag.Bool("update", false, "rewrite the golden diffs")
+)
+
+type replayCase struct {
+	name          string
+	from, to      time.Time
+	maxCandidates int
+	// synthetic cases replay hand written cassettes
+	synthetic bool
+}
+
+// file returns the testdata path of the cassette or golden diff of rc.
+func (rc replayCase) file(ext string) string {
+	name := rc.name
+	if rc.synthetic && !*record {
+		name += ".synthetic"
+	}
+	return filepath.Join("testdata", name+ext)
+}
+
+var (
+	leipzig = replayCase{
+		name:          "leipzig",
+		from:          time.Date(2025, 3, 25, 10, 14, 0, 0, time.UTC),
+		to:            time.Date(2025, 3, 25, 10, 15, 10, 0, time.UTC),
+		maxCandidates: 1,
+		synthetic:     true,
+	}
+	fallback = replayCase{
+		name:          "fallback",
+		from:          time.Date(2025, 3, 24, 18, 1, 0, 0, time.UTC),
+		to:            time.Date(2025, 3, 24, 18, 2, 10, 0, time.UTC),
+		maxCandidates: 3,
+		synthetic:     true,
+	}
+)
+
+// replayClient returns a client answering from the cassette of rc, or one
+// recording it with -record.
+func replayClient(t *testing.T, rc replayCase) (*Client, *Replayer) {
+	t.Helper()
+	client, err := New("enwiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.MaxCandidates = rc.maxCandidates
+	// a single try, a missing exchange fails right away
+	client.Retry = Retry{MaxLag: DefaultRetry.MaxLag}
+
+	path := rc.file(".json")
+	if *record {
+		recorder := &Recorder{}
+		client.HTTP = &http.Client{Transport: recorder}
+		t.Cleanup(func() {
+			if err := recorder.Cassette.Save(path); err != nil {
+				t.Error(err)
+			}
+		})
+		return client, nil
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewReplayer(cassette)
+	client.HTTP = &http.Client{Transport: replayer}
+	return client, replayer
+}
+
+func checkGolden(t *testing.T, rc replayCase, actual string) {
+	t.Helper()
+	path := rc.file(".diff")
+	if *record || *update {
+		if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(expected) != actual {
+		t.Errorf("diff does not match %s, got=\n%s", path, actual)
+	}
+}
+
+func TestReplayTopDiff(t *testing.T) {
+	cases := []struct {
+		replayCase
+		size    int
+		revID   int
+		skipped []int
+	}{
+		{leipzig, 1381, 1282274233, []int{}},
+		// the larger Mendelssohn edit was deleted before it could be compared
+		{fallback, 477, 1281233580, []int{1282274102}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client, replayer := replayClient(t, c.replayCase)
+			diff, err := client.TopDiffBetween(context.Background(), c.from, c.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, c.replayCase, diff.DiffString)
+			if *record {
+				return
+			}
+			if unused := replayer.Unused(); len(unused) > 0 {
+				t.Errorf("exchanges not replayed: %v", unused)
+			}
+
+			if diff.Size != c.size || diff.Change.RevID != c.revID {
+				t.Errorf("wrong diff, expected=%d/%d, got=%d/%d", c.revID, c.size, diff.Change.RevID, diff.Size)
+			}
+			if diff.Change.Title != "Leipzig Gewandhaus Orchestra" || diff.Wiki != "enwiki" {
+				t.Errorf("wrong page, got=%s %s", diff.Wiki, diff.Change.Title)
+			}
+			if diff.Timestamp.IsZero() || diff.Comment == "" {
+				t.Errorf("missing metadata, got=%s %q", diff.Timestamp, diff.Comment)
+			}
+			// the editor, not the author of the previous revision
+			if diff.User != "Gewandhaus archivist" {
+				t.Errorf("wrong user, expected=%q, got=%q", "Gewandhaus archivist", diff.User)
+			}
+			skipped := []int{}
+			for _, s := range diff.Skipped {
+				skipped = append(skipped, s.RevID)
+			}
+			if fmt.Sprint(skipped) != fmt.Sprint(c.skipped) {
+				t.Errorf("wrong skipped candidates, expected=%v, got=%v", c.skipped, skipped)
+			}
+		})
+	}
+}
+
+func TestReplayLongestChange(t *testing.T) {
+	if *record {
+		t.Skip("replays the cassette of TestReplayTopDiff")
+	}
+	client, _ := replayClient(t, leipzig)
+	recents, err := client.GetRecentChanges(
+		context.Background(),
+		wiki.RecentChangeRequest{RcStart: leipzig.to, RcEnd: leipzig.from},
+		DefaultMaxPages,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the window spans two pages
+	if len(recents.Query.RecentChanges) != 3 {
+		t.Errorf("wrong number of changes, expected=%d, got=%d", 3, len(recents.Query.RecentChanges))
+	}
+	longest, size := LongestChange(recents.Query.RecentChanges)
+	if longest.Title != "Leipzig Gewandhaus Orchestra" || size != 1381 {
+		t.Errorf("wrong longest change, expected=%s/%d, got=%s/%d",
+			"Leipzig Gewandhaus Orchestra", 1381, longest.Title, size)
+	}
+}
+
+// cassetteComparisons returns the successful compare responses of a
+// cassette.
+func cassetteComparisons(t *testing.T, rc replayCase) []wiki.Comparison {
+	t.Helper()
+	cassette, err := LoadCassette(rc.file(".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comparisons []wiki.Comparison
+	for _, exchange := range cassette.Exchanges {
+		u, err := url.Parse(exchange.URL)
+		if err != nil || u.Query().Get("action") != "compare" {
+			continue
+		}
+		var resp wiki.CompareResponse
+		if err := json.Unmarshal(exchange.Body, &resp); err != nil || resp.Compare.Body == "" {
+			continue
+		}
+		comparisons = append(comparisons, resp.Compare)
+	}
+	return comparisons
+}
+
+func TestReplayParseDiffText(t *testing.T) {
+	if *record {
+		t.Skip("replays the cassettes of TestReplayTopDiff")
+	}
+	for _, rc := range []replayCase{leipzig, fallback} {
+		comparisons := cassetteComparisons(t, rc)
+		if len(comparisons) != 1 {
+			t.Fatalf("%s: expected one comparison, got=%d", rc.name, len(comparisons))
+		}
+		parsed, err := ParseDiffText(comparisons[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, rc, parsed)
+	}
+
+	// without the table markup the body is not a unified diff
+	comparison := cassetteComparisons(t, leipzig)[0]
+	comparison.Body = comparison.Body[len(htmlPrefix):]
+	var decodeErr *DecodeError
+	if _, err := ParseDiffText(comparison); !errors.As(err, &decodeErr) {
+		t.Errorf("wrong error, expected=%T, got=%v", decodeErr, err)
+	}
+}
@@ -0,0 +1,226 @@
+package wiki_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Retry configures how the client retries failed MediaWiki calls.
+type Retry struct {
+	// MaxAttempts includes the first try, values below 1 mean a single try.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// MaxLag is sent as maxlag parameter, 0 leaves it out.
+	// https://www.mediawiki.org/wiki/Manual:Maxlag_parameter
+	MaxLag int
+}
+
+var DefaultRetry = Retry{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	MaxLag:      5,
+}
+
+// Metrics counts what happened to the requests of a client.
+type Metrics struct {
+	Requests      atomic.Int64
+	Retries       atomic.Int64
+	Failures      atomic.Int64
+	RateLimited   atomic.Int64
+	MaxLagged     atomic.Int64
+	HTMLResponses atomic.Int64
+}
+
+type MetricsSnapshot struct {
+	Requests      int64 `json:"requests"`
+	Retries       int64 `json:"retries"`
+	Failures      int64 `json:"failures"`
+	RateLimited   int64 `json:"rate_limited"`
+	MaxLagged     int64 `json:"maxlagged"`
+	HTMLResponses int64 `json:"html_responses"`
+}
+
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Requests:      m.Requests.Load(),
+		Retries:       m.Retries.Load(),
+		Failures:      m.Failures.Load(),
+		RateLimited:   m.RateLimited.Load(),
+		MaxLagged:     m.MaxLagged.Load(),
+		HTMLResponses: m.HTMLResponses.Load(),
+	}
+}
+
+type errorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+// retryable marks an attempt that may succeed when repeated. after is the
+// delay the server asked for, zero if it did not say.
+type retryable struct {
+	err   error
+	after time.Duration
+}
+
+func (r *retryable) Error() string {
+	return r.err.Error()
+}
+
+func (r *retryable) Unwrap() error {
+	return r.err
+}
+
+// get performs a GET against the action API and returns the JSON body.
+// Transport errors, 429/5xx, HTML responses and maxlag/ratelimited API
+// errors are retried with exponential backoff and jitter. A server asking to
+// wait longer than MaxDelay gets no retry, the error is returned instead.
+func (c *Client) get(ctx context.Context, rawURL string) ([]byte, http.Header, error) {
+	retry := c.Retry
+	if retry.MaxLag > 0 {
+		rawURL = withMaxLag(rawURL, retry.MaxLag)
+	}
+
+	for attempt := 1; ; attempt++ {
+		c.Metrics.Requests.Add(1)
+		body, header, err := c.attempt(ctx, rawURL)
+		if err == nil {
+			return body, header, nil
+		}
+
+		r, ok := err.(*retryable)
+		if !ok {
+			c.Metrics.Failures.Add(1)
+			return body, header, err
+		}
+		if attempt >= retry.MaxAttempts {
+			c.Metrics.Failures.Add(1)
+			return body, header, r.err
+		}
+		if retry.MaxDelay > 0 && r.after > retry.MaxDelay {
+			c.Metrics.Failures.Add(1)
+			log.Printf("not retrying, asked to wait %s: %s", r.after, err)
+			return body, header, r.err
+		}
+
+		delay := max(backoff(retry, attempt), r.after)
+		c.Metrics.Retries.Add(1)
+		log.Printf("retrying in %s (attempt %d/%d): %s", delay, attempt, retry.MaxAttempts, err)
+		select {
+		case <-ctx.Done():
+			c.Metrics.Failures.Add(1)
+			return nil, nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, rawURL string) ([]byte, http.Header, error) {
+	req, err := c.newRequest(ctx, rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, &retryable{err: &TransportError{URL: rawURL, Err: err}}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.Header, &retryable{err: &TransportError{URL: rawURL, Err: fmt.Errorf("error reading body: %v", err)}}
+	}
+
+	after := retryAfter(resp.Header)
+	if resp.StatusCode != http.StatusOK {
+		err := &TransportError{URL: rawURL, StatusCode: resp.StatusCode, Body: body}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			c.Metrics.RateLimited.Add(1)
+			return body, resp.Header, &retryable{err: err, after: after}
+		case resp.StatusCode >= 500:
+			return body, resp.Header, &retryable{err: err, after: after}
+		}
+		return body, resp.Header, err
+	}
+
+	if contentType := resp.Header.Get("content-type"); !strings.Contains(contentType, "application/json") {
+		c.Metrics.HTMLResponses.Add(1)
+		err := &ContentTypeError{URL: rawURL, ContentType: contentType, Body: body}
+		return body, resp.Header, &retryable{err: err}
+	}
+
+	var envelope errorEnvelope
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil {
+		apiErr := envelope.Error
+		apiErr.URL = rawURL
+		apiErr.Body = body
+		switch apiErr.Code {
+		case "maxlag":
+			c.Metrics.MaxLagged.Add(1)
+			if after == 0 {
+				after = time.Duration(apiErr.Lag * float64(time.Second))
+			}
+			return body, resp.Header, &retryable{err: apiErr, after: after}
+		case "ratelimited":
+			c.Metrics.RateLimited.Add(1)
+			return body, resp.Header, &retryable{err: apiErr, after: after}
+		}
+		return body, resp.Header, apiErr
+	}
+
+	return body, resp.Header, nil
+}
+
+func backoff(retry Retry, attempt int) time.Duration {
+	delay := retry.BaseDelay << (attempt - 1)
+	if delay <= 0 || (retry.MaxDelay > 0 && delay > retry.MaxDelay) {
+		delay = retry.MaxDelay
+	}
+	// full jitter on the upper half keeps concurrent wikis from retrying in lockstep
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func withMaxLag(rawURL string, maxLag int) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set("maxlag", strconv.Itoa(maxLag))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,125 @@
+package wiki_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testRetry = Retry{
+	MaxAttempts: 5,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    5 * time.Millisecond,
+	MaxLag:      5,
+}
+
+func TestGetRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if maxLag := r.URL.Query().Get("maxlag"); maxLag != "5" {
+			t.Errorf("wrong maxlag, expected=%s, got=%s", "5", maxLag)
+		}
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html>Wikimedia Error</html>")
+		case 3:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"error":{"code":"maxlag","info":"Waiting for 10.64.16.8: 0 seconds lagged","lag":0}}`)
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"query":{}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, Retry: testRetry}
+	body, _, err := client.get(context.Background(), server.URL+"?action=query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"query":{}}` {
+		t.Errorf("wrong body, got=%s", body)
+	}
+
+	expected := MetricsSnapshot{
+		Requests:      4,
+		Retries:       3,
+		RateLimited:   1,
+		MaxLagged:     1,
+		HTMLResponses: 1,
+	}
+	if actual := client.Metrics.Snapshot(); actual != expected {
+		t.Errorf("wrong metrics, expected=%+v, got=%+v", expected, actual)
+	}
+}
+
+func TestGetDoesNotRetryAPIErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"error":{"code":"nosuchrevid","info":"There is no revision with ID 1."}}`)
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, Retry: testRetry}
+	_, _, err := client.get(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("expected api error")
+	}
+	if calls != 1 {
+		t.Errorf("wrong number of calls, expected=%d, got=%d", 1, calls)
+	}
+}
+
+func TestGetGivesUp(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, Retry: testRetry}
+	_, _, err := client.get(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != testRetry.MaxAttempts {
+		t.Errorf("wrong number of calls, expected=%d, got=%d", testRetry.MaxAttempts, calls)
+	}
+	if failures := client.Metrics.Failures.Load(); failures != 1 {
+		t.Errorf("wrong failures, expected=%d, got=%d", 1, failures)
+	}
+}
+
+func TestGetDoesNotWaitPastMaxDelay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, Retry: testRetry}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err := client.get(ctx, server.URL)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || transportErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the rate limit error, got=%v", err)
+	}
+	if calls != 1 {
+		t.Errorf("wrong number of calls, expected=%d, got=%d", 1, calls)
+	}
+}
@@ -0,0 +1,237 @@
+package wiki_api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"widiff/wiki"
+)
+
+const StreamURL = "https://stream.wikimedia.org/v2/stream/recentchange"
+
+// Stream consumes the recentchange EventStream continuously instead of
+// polling list=recentchanges, so busy minutes are not truncated to one page.
+// The stream carries the changes of every wiki, a single connection feeds
+// the StreamSource of each configured wiki.
+type Stream struct {
+	URL        string
+	Retain     time.Duration
+	RetryDelay time.Duration
+	// HTTP and UserAgent are used for the stream connection
+	HTTP      *http.Client
+	UserAgent string
+
+	mu      sync.Mutex
+	sources map[string]*StreamSource
+	lastID  string
+}
+
+func NewStream(url string) *Stream {
+	return &Stream{
+		URL:        url,
+		Retain:     5 * time.Minute,
+		RetryDelay: 3 * time.Second,
+		HTTP:       http.DefaultClient,
+		UserAgent:  DefaultUserAgent,
+		sources:    make(map[string]*StreamSource),
+	}
+}
+
+// Source returns the WikiSource of client.Wiki, it keeps the changes of
+// that wiki received from now on and compares them with client. Stream
+// events carry no tags, a client filtering tags is refused.
+func (s *Stream) Source(client *Client) (*StreamSource, error) {
+	if client.FiltersTags {
+		return nil, fmt.Errorf("%s: stream events carry no tags, tag filters need the API source", client.Wiki)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if source, ok := s.sources[client.Wiki]; ok {
+		return source, nil
+	}
+	source := &StreamSource{Client: client, retain: s.Retain}
+	s.sources[client.Wiki] = source
+	return source, nil
+}
+
+// StreamSource holds the streamed changes of one wiki.
+type StreamSource struct {
+	// Client fetches the compare for the selected change
+	Client *Client
+	retain time.Duration
+
+	mu      sync.Mutex
+	changes []streamedChange
+}
+
+type streamedChange struct {
+	at     time.Time
+	change wiki.RecentChange
+}
+
+func (s *StreamSource) TopDiff(ctx context.Context, startingFrom time.Time) (Diff, error) {
+	window := s.Changes(startingFrom)
+	if len(window) == 0 {
+		return Diff{}, fmt.Errorf("%w received since %s", ErrNoChanges, startingFrom)
+	}
+	return s.Client.compareCandidates(ctx, window)
+}
+
+// Changes returns the changes received at or after since.
+func (s *StreamSource) Changes(since time.Time) []wiki.RecentChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var window []wiki.RecentChange
+	for _, c := range s.changes {
+		if !c.at.Before(since) {
+			window = append(window, c.change)
+		}
+	}
+	return window
+}
+
+// Largest returns the largest change received at or after since.
+func (s *StreamSource) Largest(since time.Time) (wiki.RecentChange, bool) {
+	window := s.Changes(since)
+	if len(window) == 0 {
+		return wiki.RecentChange{}, false
+	}
+	longest, _ := LongestChange(window)
+	return longest, true
+}
+
+func (s *StreamSource) add(event wiki.RecentChangeEvent) {
+	// mirror the rctype and rcnamespace filter of the polling request
+	namespaces := s.Client.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []int{0}
+	}
+	if event.Type != "edit" || !(s.Client.AllNamespaces || slices.Contains(namespaces, event.Namespace)) {
+		return
+	}
+
+	at := time.Unix(event.Timestamp, 0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, streamedChange{at: at, change: event.RecentChange()})
+
+	cutoff := at.Add(-s.retain)
+	i := 0
+	for i < len(s.changes) && s.changes[i].at.Before(cutoff) {
+		i++
+	}
+	s.changes = s.changes[i:]
+}
+
+func (s *Stream) LastEventID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Run reads the stream until ctx is done. Dropped connections are resumed
+// from the last received event id.
+func (s *Stream) Run(ctx context.Context) error {
+	for {
+		err := s.consume(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("event stream disconnected: %s", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.RetryDelay):
+		}
+	}
+}
+
+func (s *Stream) consume(ctx context.Context) error {
+	client := &Client{HTTP: s.HTTP, UserAgent: s.UserAgent}
+	req, err := client.newRequest(ctx, s.URL)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if id := s.LastEventID(); id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+
+	resp, err := client.do(req)
+	if err != nil {
+		return fmt.Errorf("error on GET request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code request: %v", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var id string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				s.handle(data.String())
+			}
+			if id != "" {
+				s.mu.Lock()
+				s.lastID = id
+				s.mu.Unlock()
+			}
+			id = ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// keep-alive comment
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				s.RetryDelay = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (s *Stream) handle(data string) {
+	var event wiki.RecentChangeEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		log.Printf("could not decode stream event: %s", err)
+		return
+	}
+	s.mu.Lock()
+	source, ok := s.sources[event.Wiki]
+	s.mu.Unlock()
+	if ok {
+		source.add(event)
+	}
+}
@@ -0,0 +1,114 @@
+package wiki_api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeEvent(w http.ResponseWriter, id int, wikiID string, oldLen, newLen int) {
+	fmt.Fprintf(w, "event: message\n")
+	fmt.Fprintf(w, "id: %d\n", id)
+	fmt.Fprintf(w,
+		"data: {\"id\":%d,\"type\":\"edit\",\"namespace\":0,\"title\":\"Page %d\",\"timestamp\":%d,\"wiki\":\"%s\",\"length\":{\"old\":%d,\"new\":%d},\"revision\":{\"old\":%d,\"new\":%d}}\n\n",
+		id, id, 1700000000+id, wikiID, oldLen, newLen, 100+id, 200+id,
+	)
+	w.(http.Flusher).Flush()
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	var mu sync.Mutex
+	var resumedFrom []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		resumedFrom = append(resumedFrom, r.Header.Get("Last-Event-ID"))
+		conn := len(resumedFrom)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, ":ok\n\n")
+		if conn == 1 {
+			writeEvent(w, 1, "enwiki", 100, 110)
+			writeEvent(w, 2, "dewiki", 100, 5000)
+			writeEvent(w, 3, "enwiki", 100, 130)
+			// drop the connection
+			return
+		}
+		writeEvent(w, 4, "enwiki", 100, 120)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	stream := NewStream(server.URL)
+	client, err := New("enwiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := stream.Source(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dewiki, err := New("dewiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deSource, err := stream.Source(dewiki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.RetryDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go stream.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for stream.LastEventID() != "4" {
+		if time.Now().After(deadline) {
+			t.Fatalf("stream did not receive all events, last id=%q", stream.LastEventID())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	expected := []string{"", "3"}
+	if fmt.Sprint(resumedFrom) != fmt.Sprint(expected) {
+		t.Errorf("wrong Last-Event-ID, expected=%v, got=%v", expected, resumedFrom)
+	}
+	mu.Unlock()
+
+	largest, ok := source.Largest(time.Unix(0, 0))
+	if !ok || largest.Rcid != 3 {
+		t.Errorf("wrong largest change, expected=%d, got=%+v", 3, largest)
+	}
+
+	largest, ok = source.Largest(time.Unix(1700000004, 0))
+	if !ok || largest.Rcid != 4 {
+		t.Errorf("wrong largest change in window, expected=%d, got=%+v", 4, largest)
+	}
+
+	// both wikis are fed by the same connection
+	largest, ok = deSource.Largest(time.Unix(0, 0))
+	if !ok || largest.Rcid != 2 {
+		t.Errorf("wrong dewiki change, expected=%d, got=%+v", 2, largest)
+	}
+}
+
+func TestStreamRefusesTagFilters(t *testing.T) {
+	client, err := New("enwiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (FilterConfig{ExcludeTags: []string{"mw-reverted"}}).Apply(client); err != nil {
+		t.Fatal(err)
+	}
+	// the filter would keep every streamed change
+	if _, err := NewStream(StreamURL).Source(client); err == nil {
+		t.Error("expected tag filters to be refused")
+	}
+}
@@ -1,16 +1,13 @@
 package wiki_api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
-	"widiff/assert"
 	"widiff/wiki"
 )
 
@@ -23,99 +20,211 @@ var TestRequest wiki.CompareRequest = wiki.CompareRequest{
 	ToRevId:   "1282274233",
 }
 
-type Client struct{}
+// DefaultMaxPages caps how many rccontinue pages are followed per request.
+const DefaultMaxPages = 50
 
-func (c *Client) TopDiff(startingFrom time.Time) (Diff, error) {
-	return topDiff(startingFrom)
+// DefaultMaxCandidates is how many of the largest changes are compared
+// before a window is given up.
+const DefaultMaxCandidates = 5
+
+// DefaultUserAgent follows https://meta.wikimedia.org/wiki/User-Agent_policy
+const DefaultUserAgent = "widiff/1.0 (https://widiffreview.onrender.com/)"
+
+type Client struct {
+	Wiki string
+	// BaseURL is the action API endpoint, e.g. https://en.wikipedia.org/w/api.php
+	BaseURL   string
+	HTTP      *http.Client
+	UserAgent string
+	MaxPages  int
+	// MaxCandidates is how many ranked changes are tried when compares fail
+	MaxCandidates int
+	// Ranker picks the top diff, nil ranks by byte delta
+	Ranker Ranker
+	// Rankers rank the diffs again later, e.g. per timeframe. Page views
+	// are looked up when Ranker or any of them needs them.
+	Rankers []Ranker
+	// Filters drop changes before ranking, Show and Namespaces are passed
+	// as rcshow and rcnamespace
+	Filters    Filters
+	Show       []string
+	Namespaces []int
+	// AllNamespaces requests every namespace, e.g. when Filters only
+	// exclude some
+	AllNamespaces bool
+	// FiltersTags is set when Filters look at the tags of a change, which
+	// streamed changes do not carry
+	FiltersTags bool
+	Retry       Retry
+	Metrics     Metrics
 }
 
-func New() *Client {
-	return &Client{}
+func (c *Client) TopDiff(ctx context.Context, startingFrom time.Time) (Diff, error) {
+	return c.topDiff(ctx, startingFrom, time.Time{})
 }
 
-func GetCompare(cReq wiki.CompareRequest) (*wiki.CompareResponse, error) {
-	client := http.DefaultClient
-	log.Printf("requesting %s", cReq.URL())
-	req, err := http.NewRequest("GET", cReq.URL(), nil)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "My User Agent 1.0")
+// TopDiffBetween returns the largest diff in the window [from, to].
+func (c *Client) TopDiffBetween(ctx context.Context, from, to time.Time) (Diff, error) {
+	return c.topDiff(ctx, from, to)
+}
+
+func New(wikiID string) (*Client, error) {
+	baseURL, err := wiki.APIURL(wikiID)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Wiki:          wikiID,
+		BaseURL:       baseURL,
+		HTTP:          http.DefaultClient,
+		UserAgent:     DefaultUserAgent,
+		MaxPages:      DefaultMaxPages,
+		MaxCandidates: DefaultMaxCandidates,
+		Retry:         DefaultRetry,
+	}, nil
+}
 
-	resp, err := client.Do(req)
+func (c *Client) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error on GET request: %v", err)
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
 	}
-	if contentType := resp.Header.Get("content-type"); !strings.Contains(contentType, "application/json") {
-		// TODO: retry if html received
-		log.Println("received html, skipping this page")
-		return nil, fmt.Errorf("did not receive json response, received: %s", contentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
 	}
+	return client.Do(req)
+}
 
-	defer resp.Body.Close()
+func (c *Client) GetCompare(ctx context.Context, cReq wiki.CompareRequest) (*wiki.CompareResponse, error) {
+	url := cReq.URL(c.BaseURL)
+	log.Printf("requesting %s", url)
+	body, _, err := c.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
 
-	var errorBody bytes.Buffer
 	var diff wiki.CompareResponse
-	r := io.TeeReader(resp.Body, &errorBody)
-	err = json.NewDecoder(r).Decode(&diff)
-
-	assert.NoError(
-		err,
-		"error unmarshaing json",
-		map[string]string{
-			"header":  fmt.Sprintf("%v", resp.Header),
-			"body":    fmt.Sprintf("%s", errorBody.String()),
-			"errType": fmt.Sprintf("%T", err),
-		},
-	)
+	err = json.Unmarshal(body, &diff)
+	if err != nil {
+		return nil, &DecodeError{URL: url, Body: body, Err: err}
+	}
 
 	return &diff, nil
 }
 
-func GetRecentChanges(rcReq wiki.RecentChangeRequest) (*wiki.RecentChangesResponse, error) {
-
-	client := http.DefaultClient
-	log.Printf("requesting %s", rcReq.URL())
-	req, _ := http.NewRequest("GET", rcReq.URL(), nil)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "My User Agent 1.0")
-
-	resp, err := client.Do(req)
-
-	if err != nil {
-		return nil, fmt.Errorf("error get request: %v", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code request: %v", resp.StatusCode)
+// GetRecentChanges follows rccontinue until all changes of the requested
+// window are collected or maxPages pages have been fetched.
+func (c *Client) GetRecentChanges(ctx context.Context, rcReq wiki.RecentChangeRequest, maxPages int) (*wiki.RecentChangesResponse, error) {
+	var all wiki.RecentChangesResponse
+	for page := 0; maxPages <= 0 || page < maxPages; page++ {
+		recent, err := c.getRecentChangesPage(ctx, rcReq)
+		if err != nil {
+			return nil, err
+		}
+		all.Query.RecentChanges = append(all.Query.RecentChanges, recent.Query.RecentChanges...)
+		all.Continue = recent.Continue
+		if recent.Continue == nil || recent.Continue.RcContinue == "" {
+			return &all, nil
+		}
+		rcReq.Continue = recent.Continue
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	log.Printf("stopped after %d pages, window is incomplete", maxPages)
+	return &all, nil
+}
+
+func (c *Client) getRecentChangesPage(ctx context.Context, rcReq wiki.RecentChangeRequest) (*wiki.RecentChangesResponse, error) {
+	url := rcReq.URL(c.BaseURL)
+	log.Printf("requesting %s", url)
+	body, _, err := c.get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("error reading body: %v", err)
+		return nil, err
 	}
 
 	var recent wiki.RecentChangesResponse
 	err = json.Unmarshal(body, &recent)
 	if err != nil {
-		fmt.Println(resp)
-		fmt.Println(rcReq.URL())
-		fmt.Printf("%s\n", body)
-		return nil, fmt.Errorf("error unmarshaling json: %v", err)
+		return nil, &DecodeError{URL: url, Body: body, Err: err}
 	}
 
 	return &recent, nil
 }
 
-// TODO: add timestamp for display in frontend
 type Diff struct {
+	// ID is set once the diff has been stored, see comparison.Repository
+	ID   int64
+	Wiki string
+	// Timestamp is the time of the edit
+	Timestamp  time.Time
 	DiffString string
 	Comment    string
 	User       string
 	Size       int
 	Review     string
+	// ReviewPending is set while the review is generated, Review is empty
+	// until then
+	ReviewPending bool
+	// Skipped lists the larger changes that could not be compared
+	Skipped []SkippedCandidate
+	// Change, Lines and Views allow ranking the diff again later
+	Change wiki.RecentChange
+	Lines  LineStats
+	Views  int
+}
+
+func (d Diff) Candidate() Candidate {
+	lines := d.Lines
+	return Candidate{Change: d.Change, Lines: &lines, Views: d.Views}
+}
+
+// SkippedCandidate is a change that ranked above the selected one but whose
+// compare failed.
+type SkippedCandidate struct {
+	Title  string `json:"title"`
+	RevID  int    `json:"revid"`
+	Size   int    `json:"size"`
+	Reason string `json:"reason"`
+}
+
+// CandidatesError is returned when none of the tried candidates could be
+// compared.
+type CandidatesError struct {
+	Skipped []SkippedCandidate
+	// Errs are the compare errors, in the order of Skipped
+	Errs []error
+}
+
+func (e *CandidatesError) Error() string {
+	return fmt.Sprintf("none of %d candidates could be compared", len(e.Skipped))
+}
+
+func (e *CandidatesError) Unwrap() []error {
+	return e.Errs
 }
 
 // TODO: additionally display change size in bytes
-func topDiff(startingFrom time.Time) (Diff, error) {
-	recents, err := GetRecentChanges(wiki.RecentChangeRequest{RcEnd: startingFrom})
+func (c *Client) topDiff(ctx context.Context, from, to time.Time) (Diff, error) {
+	recents, err := c.GetRecentChanges(
+		ctx,
+		wiki.RecentChangeRequest{
+			RcStart:       to,
+			RcEnd:         from,
+			Namespaces:    c.Namespaces,
+			AllNamespaces: c.AllNamespaces,
+			Show:          c.Show,
+		},
+		c.MaxPages,
+	)
 	if err != nil {
 		log.Printf("could not retrieve recents: %s", err)
 		return Diff{}, err
@@ -123,8 +232,105 @@ func topDiff(startingFrom time.Time) (Diff, error) {
 
 	log.Printf("num changes: %d", len(recents.Query.RecentChanges))
 
-	longest, size := LongestChange(recents.Query.RecentChanges)
+	if len(recents.Query.RecentChanges) == 0 {
+		return Diff{}, fmt.Errorf("%w since %s", ErrNoChanges, from)
+	}
+
+	return c.compareCandidates(ctx, recents.Query.RecentChanges)
+}
+
+// compareCandidates tries the best ranked changes in order until one
+// compares successfully. Errors that are not specific to a revision end the
+// search. A DiffRanker compares all tried candidates and keeps the best, an
+// error ending the search keeps the best compared so far.
+func (c *Client) compareCandidates(ctx context.Context, changes []wiki.RecentChange) (Diff, error) {
+	ranker := c.Ranker
+	if ranker == nil {
+		ranker = ByteDelta{}
+	}
 
+	changes = c.Filters.Apply(changes)
+	if len(changes) == 0 {
+		return Diff{}, fmt.Errorf("%w left after filtering", ErrNoChanges)
+	}
+	candidates := toCandidates(changes)
+	if c.needsViews(ranker) {
+		withViews, err := c.addViews(ctx, candidates)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Diff{}, ctx.Err()
+			}
+			log.Printf("could not look up page views, ranking without: %s", err)
+		} else {
+			candidates = withViews
+		}
+	}
+
+	maxCandidates := c.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = 1
+	}
+
+	_, needsDiff := ranker.(DiffRanker)
+	var ranked []Candidate
+	if needsDiff {
+		ranked = diffPool(candidates, maxCandidates)
+	} else {
+		ranked = Rank(ranker, candidates)
+		ranked = ranked[:min(maxCandidates, len(ranked))]
+	}
+
+	var skipped []SkippedCandidate
+	var errs []error
+	var best *Diff
+	for _, candidate := range ranked {
+		diff, err := c.compareChange(ctx, candidate)
+		if err != nil {
+			if !Skippable(err) {
+				if best != nil && ctx.Err() == nil {
+					log.Printf("keeping the best diff so far: %s", err)
+					break
+				}
+				return Diff{}, err
+			}
+			change := candidate.Change
+			log.Printf("skipping candidate %s (rev %d): %s", change.Title, change.RevID, err)
+			skipped = append(skipped, SkippedCandidate{
+				Title:  change.Title,
+				RevID:  change.RevID,
+				Size:   Abs(change.OldLen - change.NewLen),
+				Reason: err.Error(),
+			})
+			errs = append(errs, err)
+			continue
+		}
+		if !needsDiff {
+			diff.Skipped = skipped
+			return diff, nil
+		}
+		if best == nil || ranker.Score(diff.Candidate()) > ranker.Score(best.Candidate()) {
+			best = &diff
+		}
+	}
+	if best != nil {
+		best.Skipped = skipped
+		return *best, nil
+	}
+	return Diff{}, &CandidatesError{Skipped: skipped, Errs: errs}
+}
+
+// needsViews reports whether ranker or one of c.Rankers scores page views.
+func (c *Client) needsViews(ranker Ranker) bool {
+	for _, r := range append([]Ranker{ranker}, c.Rankers...) {
+		if _, ok := r.(ViewsRanker); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) compareChange(ctx context.Context, candidate Candidate) (Diff, error) {
+	longest := candidate.Change
 	compRequest := wiki.CompareRequest{
 		FromTitle: longest.Title,
 		ToTitle:   longest.Title,
@@ -132,7 +338,7 @@ func topDiff(startingFrom time.Time) (Diff, error) {
 		ToRevId:   strconv.Itoa(longest.RevID),
 	}
 
-	diff, err := GetCompare(compRequest)
+	diff, err := c.GetCompare(ctx, compRequest)
 	if err != nil {
 		log.Printf("could not retrieve diff: %s", err)
 		return Diff{}, err
@@ -143,10 +349,20 @@ func topDiff(startingFrom time.Time) (Diff, error) {
 		return Diff{}, err
 	}
 
+	timestamp, err := time.Parse(time.RFC3339, longest.Timestamp)
+	if err != nil {
+		log.Printf("could not parse timestamp %q: %s", longest.Timestamp, err)
+	}
+
 	return Diff{
+		Wiki:       c.Wiki,
+		Timestamp:  timestamp,
 		DiffString: parsed,
 		Comment:    diff.Compare.ToComment,
-		Size:       size,
-		User:       diff.Compare.FromUser,
+		Size:       Abs(longest.OldLen - longest.NewLen),
+		User:       longest.User,
+		Change:     longest,
+		Lines:      CountLines(parsed),
+		Views:      candidate.Views,
 	}, nil
 }
@@ -0,0 +1,178 @@
+package wiki_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"widiff/wiki"
+)
+
+func TestGetRecentChangesFollowsContinue(t *testing.T) {
+	var continues []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != "test agent" {
+			t.Errorf("wrong user agent, expected=%q, got=%q", "test agent", ua)
+		}
+		q := r.URL.Query()
+		continues = append(continues, q.Get("rccontinue")+" "+q.Get("continue"))
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch q.Get("rccontinue") {
+		case "":
+			fmt.Fprint(w, `{"continue":{"rccontinue":"20251018120000|2","continue":"-||"},"query":{"recentchanges":[{"rcid":1,"oldlen":1,"newlen":2}]}}`)
+		default:
+			fmt.Fprint(w, `{"query":{"recentchanges":[{"rcid":2,"oldlen":1,"newlen":50}]}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		Wiki:      "enwiki",
+		BaseURL:   server.URL + "/w/api.php",
+		HTTP:      server.Client(),
+		UserAgent: "test agent",
+	}
+	recents, err := client.GetRecentChanges(
+		context.Background(),
+		wiki.RecentChangeRequest{RcEnd: time.Now().Add(-time.Minute)},
+		DefaultMaxPages,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{" ", "20251018120000|2 -||"}
+	if fmt.Sprint(continues) != fmt.Sprint(expected) {
+		t.Errorf("wrong continuation, expected=%v, got=%v", expected, continues)
+	}
+	if len(recents.Query.RecentChanges) != 2 {
+		t.Errorf("wrong number of changes, expected=%d, got=%d", 2, len(recents.Query.RecentChanges))
+	}
+	longest, size := LongestChange(recents.Query.RecentChanges)
+	if longest.Rcid != 2 || size != 49 {
+		t.Errorf("wrong longest change, expected=%d, got=%d", 2, longest.Rcid)
+	}
+}
+
+func TestCompareURL(t *testing.T) {
+	cr := wiki.CompareRequest{FromTitle: "Rock & Roll", FromRevId: "1", ToRevId: "2"}
+	expected := "http://localhost/w/api.php?action=compare&difftype=unified&format=json&formatversion=2&fromrev=1&fromtitle=Rock_%26_Roll&prop=diff%7Cids%7Ctitle%7Cuser%7Ccomment&torev=2&totitle=Rock_%26_Roll&utf8=1"
+	if actual := cr.URL("http://localhost/w/api.php"); actual != expected {
+		t.Errorf("wrong url, expected=%s, got=%s", expected, actual)
+	}
+}
+
+func TestGetCompareMalformedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"compare":{"body":`)
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL}
+	_, err := client.GetCompare(context.Background(), wiki.CompareRequest{FromTitle: "A"})
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("wrong error, expected=%T, got=%T", decodeErr, err)
+	}
+	if string(RawBody(err)) != `{"compare":{"body":` {
+		t.Errorf("raw body not captured, got=%s", RawBody(err))
+	}
+	if !Skippable(err) {
+		t.Errorf("decode error should be skippable")
+	}
+}
+
+func TestParseDiffTextEmpty(t *testing.T) {
+	_, err := ParseDiffText(wiki.Comparison{FromTitle: "A", FromRevID: 1, ToRevID: 2})
+
+	var emptyErr *EmptyDiffError
+	if !errors.As(err, &emptyErr) {
+		t.Fatalf("wrong error, expected=%T, got=%T", emptyErr, err)
+	}
+}
+
+func TestTopDiffFallsBackToNextCandidate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("action") == "query" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"query":{"recentchanges":[
+				{"title":"Small","revid":30,"old_revid":3,"oldlen":10,"newlen":20},
+				{"title":"Deleted","revid":10,"old_revid":1,"oldlen":10,"newlen":9000},
+				{"title":"Cached","revid":20,"old_revid":2,"oldlen":10,"newlen":500}
+			]}}`)
+			return
+		}
+		switch q.Get("torev") {
+		case "10":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"error":{"code":"nosuchrevid","info":"There is no revision with ID 10."}}`)
+		case "20":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html></html>")
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"compare":{"fromtitle":"Small","body":"<tr><td colspan=\"4\"><pre>@@ -1 +1 @@</pre></td></tr>"}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Wiki: "enwiki", BaseURL: server.URL, MaxCandidates: 3}
+	diff, err := client.TopDiff(context.Background(), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Size != 10 {
+		t.Errorf("wrong candidate selected, expected size=%d, got=%d", 10, diff.Size)
+	}
+
+	skipped := []int{}
+	for _, s := range diff.Skipped {
+		skipped = append(skipped, s.RevID)
+	}
+	expected := []int{10, 20}
+	if fmt.Sprint(skipped) != fmt.Sprint(expected) {
+		t.Errorf("wrong skipped candidates, expected=%v, got=%v", expected, skipped)
+	}
+
+	client.MaxCandidates = 2
+	_, err = client.TopDiff(context.Background(), time.Now().Add(-time.Minute))
+	var candidatesErr *CandidatesError
+	if !errors.As(err, &candidatesErr) || len(candidatesErr.Skipped) != 2 {
+		t.Errorf("wrong error, expected=%T, got=%v", candidatesErr, err)
+	}
+}
+
+func TestTopDiffStopsOnOverload(t *testing.T) {
+	compares := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.URL.Query().Get("action") == "query" {
+			fmt.Fprint(w, `{"query":{"recentchanges":[
+				{"title":"A","revid":10,"old_revid":1,"oldlen":10,"newlen":900},
+				{"title":"B","revid":20,"old_revid":2,"oldlen":10,"newlen":500}
+			]}}`)
+			return
+		}
+		compares++
+		fmt.Fprint(w, `{"error":{"code":"ratelimited","info":"You've exceeded your rate limit."}}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Wiki: "enwiki", BaseURL: server.URL, MaxCandidates: 2}
+	_, err := client.TopDiff(context.Background(), time.Now().Add(-time.Minute))
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "ratelimited" {
+		t.Errorf("wrong error, expected=%s, got=%v", "ratelimited", err)
+	}
+	if compares != 1 {
+		t.Errorf("search went on after rate limit, expected=%d compare, got=%d", 1, compares)
+	}
+}
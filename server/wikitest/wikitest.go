@@ -0,0 +1,376 @@
+// Package wikitest runs a fake MediaWiki action API for tests. It answers
+// list=recentchanges and action=compare from scripted edits, so the feed can
+// be exercised without network.
+package wikitest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"widiff/wiki"
+)
+
+// Failure makes compares of an edit fail the way MediaWiki does.
+type Failure int
+
+const (
+	// OK compares the edit normally
+	OK Failure = iota
+	// NoSuchRevision answers with the nosuchrevid API error, as for deleted
+	// revisions
+	NoSuchRevision
+	// HTML answers with an HTML error page instead of JSON
+	HTML
+	// Empty answers with an empty diff body, as for suppressed revisions
+	Empty
+)
+
+// Edit is a scripted change of a page.
+type Edit struct {
+	Title   string
+	Ns      int
+	User    string
+	Comment string
+	// Timestamp defaults to the time the edit is added
+	Timestamp      time.Time
+	OldLen, NewLen int
+	Bot, Minor     bool
+	Tags           []string
+	// Diff is the unified diff without the table markup, one is made up if
+	// empty
+	Diff string
+	Fail Failure
+}
+
+// edit is an Edit as stored by the server.
+type edit struct {
+	Edit
+	pageID, revID, oldRevID, rcid int
+	// oldUser made the previous revision of the page
+	oldUser string
+}
+
+type Server struct {
+	*httptest.Server
+	// PageSize caps the changes per recentchanges response below rclimit, so
+	// tests can exercise continuation
+	PageSize int
+	// Now is the time of edits without a timestamp and the default rcstart
+	Now func() time.Time
+
+	mu       sync.Mutex
+	edits    []edit
+	pages    map[string]int
+	lastRev  map[string]edit
+	nextID   int
+	lagged   int
+	lag      float64
+	requests map[string]int
+}
+
+// NewServer starts a server with the given edits, close it when done.
+func NewServer(edits ...Edit) *Server {
+	s := &Server{
+		Now:      time.Now,
+		pages:    make(map[string]int),
+		lastRev:  make(map[string]edit),
+		nextID:   1000,
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(s)
+	s.Add(edits...)
+	return s
+}
+
+// APIURL is the action API endpoint, see wiki_api.Client.BaseURL.
+func (s *Server) APIURL() string {
+	return s.URL + "/w/api.php"
+}
+
+// Add records edits, each one builds on the previous revision of its page.
+func (s *Server) Add(edits ...Edit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range edits {
+		if e.Timestamp.IsZero() {
+			e.Timestamp = s.Now()
+		}
+		e.Timestamp = e.Timestamp.UTC().Truncate(time.Second)
+		if e.User == "" {
+			e.User = "Example"
+		}
+		pageID, ok := s.pages[e.Title]
+		if !ok {
+			pageID = s.id()
+			s.pages[e.Title] = pageID
+		}
+		previous := s.lastRev[e.Title]
+		stored := edit{
+			Edit:     e,
+			pageID:   pageID,
+			revID:    s.id(),
+			oldRevID: previous.revID,
+			rcid:     s.id(),
+			oldUser:  previous.User,
+		}
+		s.lastRev[e.Title] = stored
+		s.edits = append(s.edits, stored)
+	}
+}
+
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+// Lag answers the next n requests that send maxlag with the maxlag error,
+// reporting a replication lag of seconds.
+func (s *Server) Lag(n int, seconds float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lagged = n
+	s.lag = seconds
+}
+
+// Requests returns how many requests were made for action, "recentchanges"
+// for list=recentchanges.
+func (s *Server) Requests(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[action]
+}
+
+// RevID returns the revision id of the latest edit of title, 0 if there is
+// none.
+func (s *Server) RevID(title string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRev[title].revID
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/w/api.php" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	action := q.Get("action")
+	if action == "query" && q.Get("list") == "recentchanges" {
+		action = "recentchanges"
+	}
+
+	s.mu.Lock()
+	s.requests[action]++
+	lagged := s.lagged > 0 && q.Has("maxlag")
+	if lagged {
+		s.lagged--
+	}
+	lag := s.lag
+	s.mu.Unlock()
+
+	if lagged {
+		w.Header().Set("Retry-After", strconv.Itoa(int(lag)))
+		writeError(w, "maxlag", fmt.Sprintf("Waiting for 10.64.16.8: %v seconds lagged.", lag), lag)
+		return
+	}
+	switch action {
+	case "recentchanges":
+		s.recentChanges(w, q)
+	case "compare":
+		s.compare(w, q)
+	default:
+		writeError(w, "badvalue", fmt.Sprintf("Unrecognized value for parameter \"action\": %s.", action), 0)
+	}
+}
+
+// continueFormat is the timestamp format of rccontinue.
+const continueFormat = "20060102150405"
+
+func (s *Server) recentChanges(w http.ResponseWriter, q url.Values) {
+	end, err := time.Parse(time.RFC3339, q.Get("rcend"))
+	if err != nil {
+		writeError(w, "badtimestamp_rcend", "Invalid value for rcend.", 0)
+		return
+	}
+	start := s.Now()
+	if q.Has("rcstart") {
+		if start, err = time.Parse(time.RFC3339, q.Get("rcstart")); err != nil {
+			writeError(w, "badtimestamp_rcstart", "Invalid value for rcstart.", 0)
+			return
+		}
+	}
+	limit, err := strconv.Atoi(q.Get("rclimit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	if s.PageSize > 0 {
+		limit = min(limit, s.PageSize)
+	}
+	// without rcnamespace every namespace is listed
+	var namespaces map[string]bool
+	if value := q.Get("rcnamespace"); value != "" {
+		namespaces = make(map[string]bool)
+		for _, ns := range strings.Split(value, "|") {
+			namespaces[ns] = true
+		}
+	}
+	show := strings.Split(q.Get("rcshow"), "|")
+
+	var after *edit
+	if value := q.Get("rccontinue"); value != "" {
+		timestamp, rcid, ok := strings.Cut(value, "|")
+		at, err := time.Parse(continueFormat, timestamp)
+		id, idErr := strconv.Atoi(rcid)
+		if !ok || err != nil || idErr != nil || q.Get("continue") != "-||" {
+			writeError(w, "badcontinue", "Invalid continue param. You should pass the original value returned by the previous query.", 0)
+			return
+		}
+		after = &edit{Edit: Edit{Timestamp: at}, rcid: id}
+	}
+
+	s.mu.Lock()
+	var matching []edit
+	for _, e := range s.edits {
+		if e.Timestamp.Before(end) || e.Timestamp.After(start) || (namespaces != nil && !namespaces[strconv.Itoa(e.Ns)]) {
+			continue
+		}
+		if (slices.Contains(show, "!bot") && e.Bot) || (slices.Contains(show, "!minor") && e.Minor) {
+			continue
+		}
+		matching = append(matching, e)
+	}
+	s.mu.Unlock()
+
+	// newest first, like the API walks from rcstart to rcend
+	slices.SortFunc(matching, func(a, b edit) int {
+		return -compareEdits(a, b)
+	})
+	if after != nil {
+		i := slices.IndexFunc(matching, func(e edit) bool { return compareEdits(e, *after) <= 0 })
+		if i < 0 {
+			i = len(matching)
+		}
+		matching = matching[i:]
+	}
+
+	var resp wiki.RecentChangesResponse
+	resp.Query.RecentChanges = []wiki.RecentChange{}
+	for i, e := range matching {
+		if i == limit {
+			resp.Continue = &wiki.Continue{
+				RcContinue: fmt.Sprintf("%s|%d", e.Timestamp.Format(continueFormat), e.rcid),
+				Continue:   "-||",
+			}
+			break
+		}
+		resp.Query.RecentChanges = append(resp.Query.RecentChanges, e.recentChange())
+	}
+	writeJson(w, resp)
+}
+
+func compareEdits(a, b edit) int {
+	return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.rcid, b.rcid))
+}
+
+func (e edit) recentChange() wiki.RecentChange {
+	tags := e.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return wiki.RecentChange{
+		Type:          "edit",
+		Ns:            e.Ns,
+		Title:         e.Title,
+		PageID:        e.pageID,
+		RevID:         e.revID,
+		OldRevID:      e.oldRevID,
+		Rcid:          e.rcid,
+		OldLen:        e.OldLen,
+		NewLen:        e.NewLen,
+		Timestamp:     e.Timestamp.Format(time.RFC3339),
+		Comment:       e.Comment,
+		ParsedComment: e.Comment,
+		User:          e.User,
+		Bot:           e.Bot,
+		Minor:         e.Minor,
+		Tags:          tags,
+	}
+}
+
+// compare answers unified compares between two revisions of a page, only
+// the revision before torev is supported.
+func (s *Server) compare(w http.ResponseWriter, q url.Values) {
+	toRev, err := strconv.Atoi(q.Get("torev"))
+	if err != nil {
+		writeError(w, "badinteger", "Invalid value for torev.", 0)
+		return
+	}
+	s.mu.Lock()
+	i := slices.IndexFunc(s.edits, func(e edit) bool { return e.revID == toRev })
+	var e edit
+	if i >= 0 {
+		e = s.edits[i]
+	}
+	s.mu.Unlock()
+
+	if i < 0 || e.Fail == NoSuchRevision {
+		writeError(w, "nosuchrevid", fmt.Sprintf("There is no revision with ID %d.", toRev), 0)
+		return
+	}
+	if e.Fail == HTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "<!DOCTYPE html><html><head><title>Wikimedia Error</title></head>"+
+			"<body>Our servers are currently under maintenance or experiencing a technical issue.</body></html>")
+		return
+	}
+
+	body := ""
+	if e.Fail != Empty {
+		diff := e.Diff
+		if diff == "" {
+			diff = fmt.Sprintf("@@ -1 +1 @@\n-Revision %d of %s\n+Revision %d of %s\n", e.oldRevID, e.Title, e.revID, e.Title)
+		}
+		// MediaWiki escapes the wikitext for HTML
+		escaped := strings.NewReplacer("&", "&amp;", "<", "&lt;").Replace(diff)
+		body = `<tr><td colspan="4"><pre>` + escaped + `</pre></td></tr>`
+	}
+	writeJson(w, wiki.CompareResponse{Compare: wiki.Comparison{
+		FromID:    e.pageID,
+		FromRevID: e.oldRevID,
+		FromNS:    e.Ns,
+		FromTitle: e.Title,
+		FromUser:  e.oldUser,
+		ToID:      e.pageID,
+		ToRevID:   e.revID,
+		ToNS:      e.Ns,
+		ToTitle:   e.Title,
+		ToUser:    e.User,
+		Body:      body,
+		ToComment: e.Comment,
+	}})
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers like MediaWiki does for failed requests, with status
+// 200 and an error object.
+func writeError(w http.ResponseWriter, code, info string, lag float64) {
+	apiErr := map[string]any{"code": code, "info": info}
+	if code == "maxlag" {
+		apiErr["lag"] = lag
+	}
+	w.Header().Set("MediaWiki-API-Error", code)
+	writeJson(w, map[string]any{"error": apiErr})
+}
@@ -0,0 +1,104 @@
+package wikitest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"widiff/wiki"
+	"widiff/wiki_api"
+)
+
+func newClient(s *Server) *wiki_api.Client {
+	return &wiki_api.Client{
+		Wiki:          "enwiki",
+		BaseURL:       s.APIURL(),
+		HTTP:          s.Client(),
+		MaxPages:      wiki_api.DefaultMaxPages,
+		MaxCandidates: 4,
+		Retry: wiki_api.Retry{
+			MaxAttempts: 2,
+			BaseDelay:   time.Millisecond,
+			MaxDelay:    time.Millisecond,
+			MaxLag:      5,
+		},
+	}
+}
+
+func TestRecentChangesContinuation(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := NewServer(
+		Edit{Title: "Too old", Timestamp: t0.Add(-time.Hour)},
+		Edit{Title: "A", Timestamp: t0},
+		Edit{Title: "B", Timestamp: t0.Add(time.Second)},
+		Edit{Title: "C", Timestamp: t0.Add(time.Second)},
+		Edit{Title: "D", Timestamp: t0.Add(2 * time.Second)},
+		Edit{Title: "Bot", Timestamp: t0.Add(3 * time.Second), Bot: true},
+	)
+	defer s.Close()
+	s.PageSize = 2
+
+	client := newClient(s)
+	recents, err := client.GetRecentChanges(
+		context.Background(),
+		wiki.RecentChangeRequest{RcStart: t0.Add(time.Minute), RcEnd: t0, Show: []string{"!bot"}},
+		wiki_api.DefaultMaxPages,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var titles []string
+	for _, change := range recents.Query.RecentChanges {
+		titles = append(titles, change.Title)
+	}
+	expected := []string{"D", "C", "B", "A"}
+	if fmt.Sprint(expected) != fmt.Sprint(titles) {
+		t.Errorf("wrong changes, expected=%v, got=%v", expected, titles)
+	}
+	if requests := s.Requests("recentchanges"); requests != 2 {
+		t.Errorf("wrong number of pages, expected=%d, got=%d", 2, requests)
+	}
+}
+
+func TestCompareFailures(t *testing.T) {
+	now := time.Now()
+	s := NewServer(
+		Edit{Title: "Deleted", OldLen: 10, NewLen: 9000, Fail: NoSuchRevision, Timestamp: now},
+		Edit{Title: "Broken", OldLen: 10, NewLen: 5000, Fail: HTML, Timestamp: now},
+		Edit{Title: "Suppressed", OldLen: 10, NewLen: 1000, Fail: Empty, Timestamp: now},
+		Edit{Title: "Fine", User: "Editor", OldLen: 10, NewLen: 500, Diff: "@@ -1 +1 @@\n-a\n+<b> & c\n", Timestamp: now},
+	)
+	defer s.Close()
+	s.Lag(1, 0)
+
+	client := newClient(s)
+	diff, err := client.TopDiff(context.Background(), now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.Change.Title != "Fine" || diff.Change.RevID != s.RevID("Fine") {
+		t.Errorf("wrong diff, expected=%s, got=%s", "Fine", diff.Change.Title)
+	}
+	if diff.User != "Editor" {
+		t.Errorf("wrong user, expected=%q, got=%q", "Editor", diff.User)
+	}
+	expectedDiff := "diff --git a/Fine b/Fine\n\n@@ -1 +1 @@\n-a\n+&lt;b> &amp; c\n"
+	if diff.DiffString != expectedDiff {
+		t.Errorf("wrong diff text, expected=%q, got=%q", expectedDiff, diff.DiffString)
+	}
+	var skipped []string
+	for _, s := range diff.Skipped {
+		skipped = append(skipped, s.Title)
+	}
+	expected := []string{"Deleted", "Broken", "Suppressed"}
+	if fmt.Sprint(expected) != fmt.Sprint(skipped) {
+		t.Errorf("wrong skipped candidates, expected=%v, got=%v", expected, skipped)
+	}
+
+	metrics := client.Metrics.Snapshot()
+	if metrics.MaxLagged != 1 || metrics.HTMLResponses != 2 {
+		t.Errorf("wrong metrics, got=%+v", metrics)
+	}
+}